@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	mediumautopost "github.com/askcloudarchitech/mediumautopost/pkg/mediumautopost"
+	"github.com/spf13/cobra"
+)
+
+var postFile, postID string
+
+// postCmd posts a single article payload read from a file or stdin
+var postCmd = &cobra.Command{
+	Use:   "post",
+	Short: "Post a single article payload to medium.com and record it in the status store",
+	Long: `
+Reads one article payload, the same json the website generates for each article
+({"title","contentFormat","content","canonicalUrl","tags"}), from a file or from
+stdin with --file -, posts it to medium.com and records it in the status store
+so it is not posted again. It is recorded under --id, or the canonicalUrl.
+Example command: mediumautopost post --file public/posts/my-post/medium.json --envfilepath=.env
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if postFile == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(postFile)
+		}
+		if err != nil {
+			return err
+		}
+		article := mediumautopost.ArticleJSONData{}
+		err = json.Unmarshal(data, &article)
+		if err != nil {
+			return err
+		}
+		return mediumautopost.PostArticle(dotEnvPath, article, postID)
+	},
+}
+
+func init() {
+	postCmd.Flags().StringVarP(&postFile, "file", "f", "", "Article json file to post, - reads it from stdin")
+	postCmd.Flags().StringVar(&postID, "id", "", "ID to record the article under, defaults to its canonicalUrl")
+	postCmd.MarkFlagRequired("file")
+	rootCmd.AddCommand(postCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	mediumautopost "github.com/askcloudarchitech/mediumautopost/pkg/mediumautopost"
+	"github.com/spf13/cobra"
+)
+
+// retryCmd requeues a failed or dead-lettered article
+var retryCmd = &cobra.Command{
+	Use:   "retry <id>",
+	Short: "Requeue a failed or dead-lettered article so the next run posts it again",
+	Long: `
+Articles that fail to post are kept in a retry queue in the status store and are
+retried by later runs with growing delays. After RETRY_MAX_ATTEMPTS attempts they
+are dead-lettered and every run reports them. Once the problem is fixed, this
+resets the attempts of the article with the given id so the next run posts it.
+Example command: mediumautopost retry https://your.website/posts/my-post/ --envfilepath=.env
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return mediumautopost.RetryArticle(dotEnvPath, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(retryCmd)
+}
@@ -35,5 +35,5 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&dotEnvPath, "envfilepath", "e", "", "Path to your environment file. if left empty, the program will only use system environment variables.")
+	rootCmd.PersistentFlags().StringVarP(&dotEnvPath, "envfilepath", "e", "", "Path to your environment file. if left empty, the program will only use system environment variables.")
 }
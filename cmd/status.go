@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	mediumautopost "github.com/askcloudarchitech/mediumautopost/pkg/mediumautopost"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd groups the commands that manage the status store
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Manage the store that keeps track of which articles were already posted",
+}
+
+// statusMigrateCmd upgrades the status store to the current schema version
+var statusMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the status store in place to the current schema version",
+	Long: `
+Rewrites the configured status store (STORAGE_TYPE) in the current schema version.
+Older versions are still read on every run, so this is optional, but it turns
+the old Go formatted timestamps into RFC3339 ones and adds the new fields.
+Example command: mediumautopost status migrate --envfilepath=.env
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return mediumautopost.MigrateStatus(dotEnvPath)
+	},
+}
+
+var copyFrom, copyTo string
+
+// statusCopyCmd copies the status from one storage backend to another
+var statusCopyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy the status from one storage backend to another",
+	Long: `
+Loads every posted article from one status store and writes it to another, then
+reads the destination back to check that nothing is missing. Both stores are
+configured from the same env file, so set the variables for both of them.
+Articles already in the destination are kept. Nothing is posted to medium.com.
+Example command: mediumautopost status copy --from GITHUB --to SQLITE --envfilepath=.env
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if copyFrom == "" || copyTo == "" {
+			return fmt.Errorf("both --from and --to are required, available backends are %v", mediumautopost.StorageTypes())
+		}
+		return mediumautopost.CopyStatus(dotEnvPath, mediumautopost.StorageType(copyFrom), mediumautopost.StorageType(copyTo))
+	},
+}
+
+func init() {
+	statusCopyCmd.Flags().StringVar(&copyFrom, "from", "", "Storage backend to copy from, e.g. GITHUB")
+	statusCopyCmd.Flags().StringVar(&copyTo, "to", "", "Storage backend to copy to, e.g. SQLITE")
+	statusCmd.AddCommand(statusCopyCmd)
+	statusCmd.AddCommand(statusMigrateCmd)
+	rootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,97 @@
+package mediumautopost
+
+import (
+	"log"
+	"path"
+	"strings"
+)
+
+// filterArticles applies the filtering rules from the config to the articles that have not been posted yet.
+// an article is skipped when:
+//   - it is a draft, or syndicate is false in the index
+//   - it is older than SINCE
+//   - its section doesn't match INCLUDE_SECTIONS or matches EXCLUDE_SECTIONS
+//   - none of its tags match INCLUDE_TAGS or one of them matches EXCLUDE_TAGS
+//   - its lang doesn't match INCLUDE_LANGS
+//
+// the patterns are case insensitive globs like "notes" or "link*". a rule only applies to articles
+// that have the field it looks at, e.g. an article without a date is never too old.
+func filterArticles(c Config, articles []ArticleIndexItem) []ArticleIndexItem {
+	filtered := []ArticleIndexItem{}
+	for _, article := range articles {
+		reason := skipReason(c, article)
+		if reason != "" {
+			log.Printf("skipping %s: %s", article.URL, reason)
+			continue
+		}
+		filtered = append(filtered, article)
+	}
+	if len(filtered) != len(articles) {
+		log.Printf("after applying the filtering rules, %v articles will be published to medium", len(filtered))
+	}
+	return filtered
+}
+
+// skipReason returns why the article should not be posted, or an empty string if it should.
+func skipReason(c Config, article ArticleIndexItem) string {
+	if article.Draft {
+		return "it is a draft"
+	}
+	if article.Syndicate != nil && !*article.Syndicate {
+		return "syndicate is false"
+	}
+	if !c.Since.IsZero() && article.Date != "" {
+		date, err := parseLooseTime(article.Date)
+		if err != nil {
+			return err.Error()
+		}
+		if date.Before(c.Since) {
+			return "it is older than SINCE"
+		}
+	}
+	if article.Section != "" {
+		if len(c.IncludeSections) > 0 && !matchesAny(c.IncludeSections, article.Section) {
+			return "its section is not in INCLUDE_SECTIONS"
+		}
+		if matchesAny(c.ExcludeSections, article.Section) {
+			return "its section is in EXCLUDE_SECTIONS"
+		}
+	}
+	if len(article.Tags) > 0 {
+		if len(c.IncludeTags) > 0 && !matchesAny(c.IncludeTags, article.Tags...) {
+			return "none of its tags are in INCLUDE_TAGS"
+		}
+		if matchesAny(c.ExcludeTags, article.Tags...) {
+			return "one of its tags is in EXCLUDE_TAGS"
+		}
+	}
+	if article.Lang != "" && len(c.IncludeLangs) > 0 && !matchesAny(c.IncludeLangs, article.Lang) {
+		return "its lang is not in INCLUDE_LANGS"
+	}
+	return ""
+}
+
+// matchesAny reports whether one of the values matches one of the glob patterns, ignoring case.
+func matchesAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+			if err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated config value, dropping empty entries.
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
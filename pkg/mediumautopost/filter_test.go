@@ -0,0 +1,89 @@
+package mediumautopost
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSkipReason(t *testing.T) {
+	no, yes := false, true
+	since := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		config  Config
+		article ArticleIndexItem
+		// want is part of the reason, empty if the article is posted
+		want string
+	}{
+		{name: "no rules", article: ArticleIndexItem{Section: "posts", Tags: []string{"go"}, Lang: "en", Date: "2000-01-01"}},
+		{name: "draft", article: ArticleIndexItem{Draft: true}, want: "draft"},
+		{name: "syndicate false", article: ArticleIndexItem{Syndicate: &no}, want: "syndicate is false"},
+		{name: "syndicate true", article: ArticleIndexItem{Syndicate: &yes}},
+
+		{name: "older than since", config: Config{Since: since}, article: ArticleIndexItem{Date: "2022-05-31"}, want: "older than SINCE"},
+		{name: "newer than since", config: Config{Since: since}, article: ArticleIndexItem{Date: "2022-06-02T10:00:00+02:00"}},
+		{name: "since with rfc1123", config: Config{Since: since}, article: ArticleIndexItem{Date: "Tue, 31 May 2022 10:00:00 +0000"}, want: "older than SINCE"},
+		{name: "since without a date", config: Config{Since: since}},
+		{name: "since with an invalid date", config: Config{Since: since}, article: ArticleIndexItem{Date: "last week"}, want: "invalid date"},
+		{name: "invalid date without since", article: ArticleIndexItem{Date: "last week"}},
+
+		{name: "included section", config: Config{IncludeSections: []string{"posts"}}, article: ArticleIndexItem{Section: "Posts"}},
+		{name: "section not included", config: Config{IncludeSections: []string{"posts"}}, article: ArticleIndexItem{Section: "notes"}, want: "not in INCLUDE_SECTIONS"},
+		{name: "section glob", config: Config{IncludeSections: []string{"post*", "essays"}}, article: ArticleIndexItem{Section: "postmortems"}},
+		{name: "excluded section", config: Config{ExcludeSections: []string{"notes", "link*"}}, article: ArticleIndexItem{Section: "LinkBlog"}, want: "in EXCLUDE_SECTIONS"},
+		{name: "exclude wins over include", config: Config{IncludeSections: []string{"*"}, ExcludeSections: []string{"notes"}}, article: ArticleIndexItem{Section: "notes"}, want: "in EXCLUDE_SECTIONS"},
+		{name: "section rules without a section", config: Config{IncludeSections: []string{"posts"}}},
+
+		{name: "one included tag", config: Config{IncludeTags: []string{"go", "rust"}}, article: ArticleIndexItem{Tags: []string{"cloud", "Go"}}},
+		{name: "no included tag", config: Config{IncludeTags: []string{"go"}}, article: ArticleIndexItem{Tags: []string{"cloud", "aws"}}, want: "INCLUDE_TAGS"},
+		{name: "tag glob", config: Config{IncludeTags: []string{"cloud-*"}}, article: ArticleIndexItem{Tags: []string{"cloud-native"}}},
+		{name: "one excluded tag", config: Config{ExcludeTags: []string{"private"}}, article: ArticleIndexItem{Tags: []string{"go", "private"}}, want: "EXCLUDE_TAGS"},
+		{name: "included and excluded tag", config: Config{IncludeTags: []string{"go"}, ExcludeTags: []string{"wip"}}, article: ArticleIndexItem{Tags: []string{"go", "WIP"}}, want: "EXCLUDE_TAGS"},
+		{name: "tag rules without tags", config: Config{IncludeTags: []string{"go"}}},
+
+		{name: "included lang", config: Config{IncludeLangs: []string{"en*"}}, article: ArticleIndexItem{Lang: "en-US"}},
+		{name: "lang not included", config: Config{IncludeLangs: []string{"en", "fr"}}, article: ArticleIndexItem{Lang: "de"}, want: "INCLUDE_LANGS"},
+		{name: "lang rules without a lang", config: Config{IncludeLangs: []string{"en"}}},
+
+		{name: "draft before the other rules", config: Config{IncludeTags: []string{"go"}}, article: ArticleIndexItem{Draft: true, Tags: []string{"rust"}}, want: "draft"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := skipReason(test.config, test.article)
+			if (test.want == "") != (got == "") || !strings.Contains(got, test.want) {
+				t.Fatalf("skipReason() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		values   []string
+		want     bool
+	}{
+		{[]string{"go"}, []string{"go"}, true},
+		{[]string{"Go"}, []string{"GO"}, true},
+		{[]string{"go"}, []string{"golang"}, false},
+		{[]string{"go*"}, []string{"golang"}, true},
+		{[]string{"*-native"}, []string{"cloud-native"}, true},
+		{[]string{"v?"}, []string{"v2"}, true},
+		{[]string{"[ab]log"}, []string{"blog", "vlog"}, true},
+		{[]string{"rust", "go"}, []string{"python", "go"}, true},
+		{[]string{"rust"}, []string{"python", "go"}, false},
+		{[]string{"posts/*"}, []string{"posts/2022"}, true},
+		{[]string{"*"}, []string{"posts/2022"}, false},
+		// an invalid pattern never matches
+		{[]string{"[go"}, []string{"[go"}, false},
+		{nil, []string{"go"}, false},
+		{[]string{"go"}, nil, false},
+	}
+	for _, test := range tests {
+		got := matchesAny(test.patterns, test.values...)
+		if got != test.want {
+			t.Errorf("matchesAny(%q, %q) = %v, want %v", test.patterns, test.values, got, test.want)
+		}
+	}
+}
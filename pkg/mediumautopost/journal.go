@@ -0,0 +1,85 @@
+package mediumautopost
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// defaultJournalPath is used when JOURNAL_PATH is empty. it is relative to the working directory.
+const defaultJournalPath = ".mediumautopost-journal.jsonl"
+
+// journal is a write-ahead log of articles posted to medium.com that may not be in the status store yet.
+// every successful post is appended right away, so if the run dies before the status store is saved
+// the next run can merge them back in instead of posting them again. one json PublishedArticle per line.
+type journal struct {
+	path string
+}
+
+func newJournal(c Config) *journal {
+	path := c.JournalPath
+	if path == "" {
+		path = defaultJournalPath
+	}
+	return &journal{path: path}
+}
+
+// Replay returns every article recorded in the journal. a missing journal means there is nothing to replay.
+// a partially written last line (the process was killed mid-write) is ignored.
+func (j *journal) Replay() ([]PublishedArticle, error) {
+	publishedArticles := []PublishedArticle{}
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return publishedArticles, nil
+	}
+	if err != nil {
+		return publishedArticles, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		article, err := decodePublishedArticle(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		publishedArticles = append(publishedArticles, article)
+	}
+	return publishedArticles, scanner.Err()
+}
+
+// Record appends an article to the journal and flushes it to disk before returning.
+func (j *journal) Record(article PublishedArticle) error {
+	line, err := json.Marshal(article)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Clear removes the journal once everything in it has been saved to the status store.
+func (j *journal) Clear() error {
+	err := os.Remove(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
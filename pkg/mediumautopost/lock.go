@@ -0,0 +1,196 @@
+package mediumautopost
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// defaultLockTTL is used when LOCK_TTL is empty. a lock older than this is considered abandoned.
+const defaultLockTTL = 30 * time.Minute
+
+// minLockTTL is the shortest LOCK_TTL. the lock is renewed every third of it, which must leave time for the
+// round trips to the store.
+const minLockTTL = time.Minute
+
+// ErrLocked is returned by StatusStore.Lock when another run holds the lock.
+var ErrLocked = errors.New("status store is locked by another run")
+
+// lockInfo is what is written to the lock so other runs can tell who holds it and until when.
+type lockInfo struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Token    string    `json:"token"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+func newLockInfo(ttl time.Duration) (lockInfo, error) {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return lockInfo{}, err
+	}
+	hostname, _ := os.Hostname()
+	now := time.Now().UTC()
+	return lockInfo{
+		PID:      os.Getpid(),
+		Hostname: hostname,
+		Token:    hex.EncodeToString(token),
+		Acquired: now,
+		Expires:  now.Add(ttl),
+	}, nil
+}
+
+func (l lockInfo) String() string {
+	return fmt.Sprintf("pid %v on %s since %s (expires %s)", l.PID, l.Hostname, l.Acquired.Format(time.RFC3339), l.Expires.Format(time.RFC3339))
+}
+
+// parseLockInfo decodes a lock. a lock that can't be decoded is returned as already expired so it can be taken over.
+func parseLockInfo(data []byte) lockInfo {
+	info := lockInfo{}
+	if json.Unmarshal(data, &info) != nil {
+		return lockInfo{}
+	}
+	return info
+}
+
+// lockBackend is the storage specific part of a lock. every store keeps a small lock document next to its status
+// that can be created only if it does not exist, and replaced or deleted only if it has not changed since it was read.
+// version identifies what was read (a commit sha, an etag, a token...) so the replace and delete can be conditional.
+type lockBackend interface {
+	createLock(info lockInfo) (created bool, err error)
+	readLock() (info lockInfo, version string, exists bool, err error)
+	replaceLock(info lockInfo, version string) (replaced bool, err error)
+	deleteLock(version string) error
+}
+
+// acquireLock takes the lock for this run. if another run holds a lock that is past its expiry it is taken over.
+// the returned function releases the lock, unless someone else took it over in the meantime.
+func acquireLock(b lockBackend, ttl time.Duration) (func() error, error) {
+	info, err := newLockInfo(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := b.createLock(info)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		current, version, exists, err := b.readLock()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !exists:
+			// released between our create and read, try once more
+			created, err = b.createLock(info)
+			if err != nil {
+				return nil, err
+			}
+			if !created {
+				return nil, ErrLocked
+			}
+		case time.Now().Before(current.Expires):
+			return nil, fmt.Errorf("%w: held by %s", ErrLocked, current)
+		default:
+			log.Printf("taking over stale lock held by %s", current)
+			replaced, err := b.replaceLock(info, version)
+			if err != nil {
+				return nil, err
+			}
+			if !replaced {
+				return nil, fmt.Errorf("%w: someone else took over the stale lock first", ErrLocked)
+			}
+		}
+	}
+	log.Printf("acquired lock until %s", info.Expires.Format(time.RFC3339))
+
+	return func() error {
+		current, version, exists, err := b.readLock()
+		if err != nil {
+			return err
+		}
+		if !exists || current.Token != info.Token {
+			log.Println("lock was taken over by another run, not releasing it")
+			return nil
+		}
+		return b.deleteLock(version)
+	}, nil
+}
+
+// keepLock renews the lock of this run in the background until ctx is done, so a run that takes longer than the
+// ttl (many articles, long Retry-After waits) does not have its lock taken over. every third of the ttl the expiry
+// is moved forward. lost is called when the lock was taken over, or could not be renewed before it expires,
+// so the run stops posting. the returned channel is closed once the renewal stopped.
+func keepLock(ctx context.Context, b lockBackend, lost func()) <-chan struct{} {
+	done := make(chan struct{})
+	info, _, exists, err := b.readLock()
+	if err != nil || !exists {
+		log.Printf("can't read the lock of this run to renew it: %v", err)
+		lost()
+		close(done)
+		return done
+	}
+	ttl := info.Expires.Sub(info.Acquired)
+	interval := ttl / 3
+	if interval <= 0 {
+		log.Printf("can't renew the lock of this run, it expires right away (%s)", info)
+		lost()
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewed, err := renewLock(b, &info, ttl)
+			if err != nil && time.Now().Add(interval).Before(info.Expires) {
+				log.Printf("error renewing the lock, trying again: %v", err)
+				continue
+			}
+			if err != nil || !renewed {
+				log.Printf("lost the lock (%v), not posting anything else", err)
+				lost()
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// renewLock moves the expiry of the lock forward, if it is still ours. info is updated with the new expiry.
+func renewLock(b lockBackend, info *lockInfo, ttl time.Duration) (bool, error) {
+	current, currentVersion, exists, err := b.readLock()
+	if err != nil {
+		return false, err
+	}
+	if !exists || current.Token != info.Token {
+		return false, nil
+	}
+	renewed := *info
+	renewed.Expires = time.Now().UTC().Add(ttl)
+	replaced, err := b.replaceLock(renewed, currentVersion)
+	if err != nil || !replaced {
+		return false, err
+	}
+	*info = renewed
+	return true, nil
+}
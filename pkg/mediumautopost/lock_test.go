@@ -0,0 +1,133 @@
+package mediumautopost
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testFileStore(t *testing.T, ttl time.Duration) *fileStore {
+	t.Helper()
+	store, err := newFileStore(Config{StorageFile: filepath.Join(t.TempDir(), "status.json"), LockTTL: ttl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*fileStore)
+}
+
+func TestAcquireLock(t *testing.T) {
+	store := testFileStore(t, 50*time.Millisecond)
+	release, err := store.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock() = %v, want ErrLocked", err)
+	}
+
+	// once expired the lock is taken over, and the first run does not release the new one
+	time.Sleep(60 * time.Millisecond)
+	releaseTakenOver, err := store.Lock()
+	if err != nil {
+		t.Fatalf("Lock() of a stale lock = %v, want a takeover", err)
+	}
+	err = release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists, _ := store.readLock(); !exists {
+		t.Fatal("the first run released the lock that was taken over")
+	}
+	err = releaseTakenOver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists, _ := store.readLock(); exists {
+		t.Fatal("the lock was not released")
+	}
+}
+
+func TestKeepLockRenews(t *testing.T) {
+	store := testFileStore(t, 60*time.Millisecond)
+	err := withLock(store, func(ctx context.Context) error {
+		time.Sleep(200 * time.Millisecond)
+		if ctx.Err() != nil {
+			t.Fatal("the lock was lost although it was renewed")
+		}
+		info, _, exists, err := store.readLock()
+		if err != nil || !exists || !info.Expires.After(time.Now()) {
+			t.Fatalf("lock = %+v, %v, want it renewed past now", info, err)
+		}
+		if _, err := store.Lock(); !errors.Is(err, ErrLocked) {
+			t.Fatalf("Lock() of a renewed lock = %v, want ErrLocked", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, exists, _ := store.readLock(); exists {
+		t.Fatal("the lock was not released")
+	}
+}
+
+func TestKeepLockNoticesTakeover(t *testing.T) {
+	store := testFileStore(t, 60*time.Millisecond)
+	err := withLock(store, func(ctx context.Context) error {
+		_, version, _, err := store.readLock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := newLockInfo(time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replaced, err := store.replaceLock(other, version)
+		if err != nil || !replaced {
+			t.Fatalf("replaceLock() = %v, %v", replaced, err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("the takeover was not noticed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _, exists, _ := store.readLock(); !exists || info.Expires.Before(time.Now().Add(time.Minute)) {
+		t.Fatal("the lock of the other run was released or changed")
+	}
+}
+
+func TestGetconfigRejectsShortLockTTL(t *testing.T) {
+	for value, valid := range map[string]bool{"2ns": false, "30s": false, "-5m": false, "soon": false, "1m": true, "45m": true} {
+		t.Setenv("LOCK_TTL", value)
+		config, err := getconfig("")
+		if valid != (err == nil) {
+			t.Fatalf("getconfig() with LOCK_TTL=%s = %v, want valid %v", value, err, valid)
+		}
+		if valid && config.LockTTL < minLockTTL {
+			t.Fatalf("LOCK_TTL=%s gave %v", value, config.LockTTL)
+		}
+	}
+}
+
+func TestKeepLockExpiredLock(t *testing.T) {
+	store := testFileStore(t, time.Hour)
+	// a ttl of 2ns, as with LOCK_TTL=2ns before it was rejected, renews every 0ns
+	now := time.Now()
+	info := lockInfo{Token: "token", Acquired: now, Expires: now.Add(2)}
+	created, err := store.createLock(info)
+	if err != nil || !created {
+		t.Fatalf("createLock() = %v, %v", created, err)
+	}
+	lost := false
+	<-keepLock(context.Background(), store, func() { lost = true })
+	if !lost {
+		t.Fatal("a lock that can't be renewed was not reported as lost")
+	}
+}
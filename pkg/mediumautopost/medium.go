@@ -0,0 +1,296 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mediumTimeout bounds each request to the medium.com API, on top of the caller's context.
+const mediumTimeout = 30 * time.Second
+
+// defaultMediumRetries is used when MEDIUM_MAX_RETRIES is empty.
+const defaultMediumRetries = 3
+
+// mediumMaxRetryAfter is the longest Retry-After that is waited for. medium.com asks for longer waits when a daily
+// limit is reached, it is then better to stop and let the next run try again.
+const mediumMaxRetryAfter = 5 * time.Minute
+
+// MediumUser is the medium.com user the token belongs to.
+type MediumUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	ImageURL string `json:"imageUrl"`
+}
+
+// MediumError is returned when the medium.com API answers with an error. Code is medium's error code
+// (e.g. 6000 for an invalid token) when the response has one. RetryAfter is set from the Retry-After header.
+type MediumError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Code       int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *MediumError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("medium: %s %s: %d %s: %s (%d)", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message, e.Code)
+	}
+	return fmt.Sprintf("medium: %s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Temporary reports whether the request may succeed when it is sent again: medium.com is rate limiting (429) or has
+// a problem of its own (5xx). other errors, like an invalid token or content medium.com does not accept, are permanent.
+func (e *MediumError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode/100 == 5
+}
+
+// isRetryable reports whether a failed request to medium.com is worth retrying. besides temporary API errors that
+// is any network error, e.g. a timeout or a reset connection.
+//
+// creating a post is not idempotent: after a 5xx or a timeout the post may have been created anyway and sending
+// the request again would post it twice. so those are only retried on a 429, which medium.com answers before doing
+// anything, or when the connection could not be made and the request never reached medium.com.
+func isRetryable(err error, idempotent bool) bool {
+	var mediumErr *MediumError
+	if errors.As(err, &mediumErr) {
+		if !idempotent {
+			return mediumErr.StatusCode == http.StatusTooManyRequests
+		}
+		return mediumErr.Temporary()
+	}
+	if !idempotent {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// isMediumStatus reports whether err is a MediumError with one of the given status codes.
+func isMediumStatus(err error, codes ...int) bool {
+	var mediumErr *MediumError
+	if !errors.As(err, &mediumErr) {
+		return false
+	}
+	for _, code := range codes {
+		if mediumErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// mediumPost is a post as returned by the medium.com API. the fields and their json names are the ones
+// of the medium sdk's Post that earlier versions stored in the status, see publishedArticleV1.
+type mediumPost struct {
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	AuthorID     string   `json:"authorId"`
+	Tags         []string `json:"tags"`
+	URL          string   `json:"url"`
+	CanonicalURL string   `json:"canonicalUrl"`
+	PublishState string   `json:"publishStatus"`
+	License      string   `json:"license"`
+	LicenseURL   string   `json:"licenseUrl"`
+}
+
+// mediumPublication is a publication the user is a member of.
+type mediumPublication struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	ImageURL    string `json:"imageUrl"`
+}
+
+// mediumContributor is an editor or writer of a publication.
+type mediumContributor struct {
+	PublicationID string `json:"publicationId"`
+	UserID        string `json:"userId"`
+	Role          string `json:"role"`
+}
+
+// mediumClient talks to the medium.com API at MEDIUM_ENDPOINT_PREFIX with the integration token. it replaces the
+// unmaintained medium sdk, which ignored the configured endpoint, could not be cancelled and failed to decode the
+// publications endpoints.
+//
+// requests that fail with a retryable error are sent again up to MEDIUM_MAX_RETRIES times, waiting with exponential
+// backoff and jitter from retryDelay, or as long as medium.com asks for with Retry-After.
+type mediumClient struct {
+	client     http.Client
+	baseURL    string
+	token      string
+	retries    int
+	retryDelay time.Duration
+}
+
+func newMediumClient(c Config) *mediumClient {
+	return &mediumClient{
+		client:  http.Client{Timeout: mediumTimeout},
+		baseURL: strings.TrimRight(c.MediumEndpointPrefix, "/"),
+		token:   c.MediumBearerToken,
+		retries: c.MediumMaxRetries,
+		// the first retry waits a second, the next ones twice as long as the previous
+		retryDelay: time.Second,
+	}
+}
+
+// getUser returns the user the token belongs to.
+func (m *mediumClient) getUser(ctx context.Context) (*MediumUser, error) {
+	user := &MediumUser{}
+	_, err := m.do(ctx, http.MethodGet, "/me", nil, user)
+	return user, err
+}
+
+// getUserPublications lists the publications the user is a member of.
+func (m *mediumClient) getUserPublications(ctx context.Context, userID string) ([]mediumPublication, error) {
+	publications := []mediumPublication{}
+	_, err := m.do(ctx, http.MethodGet, fmt.Sprintf("/users/%s/publications", userID), nil, &publications)
+	return publications, err
+}
+
+// getPublicationContributors lists the editors and writers of a publication.
+func (m *mediumClient) getPublicationContributors(ctx context.Context, publicationID string) ([]mediumContributor, error) {
+	contributors := []mediumContributor{}
+	_, err := m.do(ctx, http.MethodGet, fmt.Sprintf("/publications/%s/contributors", publicationID), nil, &contributors)
+	return contributors, err
+}
+
+// createPost creates a post on the user's profile. it also returns the raw json of the created post.
+func (m *mediumClient) createPost(ctx context.Context, userID string, request createPostRequest) (*mediumPost, json.RawMessage, error) {
+	post := &mediumPost{}
+	data, err := m.do(ctx, http.MethodPost, fmt.Sprintf("/users/%s/posts", userID), request, post)
+	return post, data, err
+}
+
+// createPublicationPost submits a post to a publication. it also returns the raw json of the created post.
+func (m *mediumClient) createPublicationPost(ctx context.Context, publicationID string, request createPostRequest) (*mediumPost, json.RawMessage, error) {
+	post := &mediumPost{}
+	data, err := m.do(ctx, http.MethodPost, fmt.Sprintf("/publications/%s/posts", publicationID), request, post)
+	return post, data, err
+}
+
+// do sends a request to the API, retrying it while it fails with a retryable error. only GET requests are idempotent.
+func (m *mediumClient) do(ctx context.Context, method, path string, in, out interface{}) (json.RawMessage, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		data, err := m.send(ctx, method, path, body, out)
+		if err == nil || !isRetryable(err, method == http.MethodGet) || ctx.Err() != nil {
+			return data, err
+		}
+		if attempt > m.retries {
+			return nil, fmt.Errorf("giving up after %v attempts: %w", attempt, err)
+		}
+		wait := backoff(attempt, m.retryDelay)
+		var mediumErr *MediumError
+		if errors.As(err, &mediumErr) && mediumErr.RetryAfter > wait {
+			if mediumErr.RetryAfter > mediumMaxRetryAfter {
+				return nil, fmt.Errorf("not retrying, medium.com asks to wait %v: %w", mediumErr.RetryAfter, err)
+			}
+			wait = mediumErr.RetryAfter
+		}
+		log.Printf("%v, retrying in %v", err, wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send sends a request to the API once. the API wraps results in {"data": ...} and errors in
+// {"errors": [{"message": ..., "code": ...}]}. the data is decoded into out and also returned as is.
+func (m *mediumClient) send(ctx context.Context, method, path string, in []byte, out interface{}) (json.RawMessage, error) {
+	var body io.Reader
+	if in != nil {
+		body = bytes.NewReader(in)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Charset", "utf-8")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+			Code    int    `json:"code"`
+		} `json:"errors"`
+	}{}
+	decodeErr := json.Unmarshal(respBody, &envelope)
+	if resp.StatusCode/100 != 2 {
+		mediumErr := &MediumError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(respBody)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		if decodeErr == nil && len(envelope.Errors) > 0 {
+			mediumErr.Code = envelope.Errors[0].Code
+			mediumErr.Message = envelope.Errors[0].Message
+		}
+		return nil, mediumErr
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("medium: %s %s: invalid response: %v", method, path, decodeErr)
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		err = json.Unmarshal(envelope.Data, out)
+	}
+	return envelope.Data, err
+}
+
+// parseRetryAfter reads a Retry-After header, either a number of seconds or an http date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
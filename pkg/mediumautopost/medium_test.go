@@ -0,0 +1,101 @@
+package mediumautopost
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testMediumClient(baseURL string) *mediumClient {
+	client := newMediumClient(Config{MediumEndpointPrefix: baseURL, MediumBearerToken: "token", MediumMaxRetries: 2})
+	client.retryDelay = time.Millisecond
+	return client
+}
+
+func TestMediumClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		status   int
+		attempts int
+	}{
+		{"get is retried on 5xx", http.MethodGet, http.StatusServiceUnavailable, 3},
+		{"get is retried on 429", http.MethodGet, http.StatusTooManyRequests, 3},
+		{"get is not retried on 400", http.MethodGet, http.StatusBadRequest, 1},
+		{"post is retried on 429", http.MethodPost, http.StatusTooManyRequests, 3},
+		{"post is not retried on 5xx", http.MethodPost, http.StatusBadGateway, 1},
+		{"post is not retried on 401", http.MethodPost, http.StatusUnauthorized, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				w.WriteHeader(test.status)
+				w.Write([]byte(`{"errors":[{"message":"nope","code":6000}]}`))
+			}))
+			defer server.Close()
+
+			_, err := testMediumClient(server.URL).do(context.Background(), test.method, "/users/user1/posts", nil, nil)
+			var mediumErr *MediumError
+			if !errors.As(err, &mediumErr) || mediumErr.StatusCode != test.status || mediumErr.Code != 6000 || mediumErr.Message != "nope" {
+				t.Fatalf("do() = %#v, want a MediumError with status %v and code 6000", err, test.status)
+			}
+			if attempts != test.attempts {
+				t.Fatalf("sent %v requests, want %v", attempts, test.attempts)
+			}
+		})
+	}
+}
+
+func TestMediumClientDoesNotRetryPostTimeout(t *testing.T) {
+	// the handler is still running when the client gives up
+	attempts := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := testMediumClient(server.URL)
+	client.client.Timeout = 20 * time.Millisecond
+
+	_, _, err := client.createPost(context.Background(), "user1", createPostRequest{Title: "title"})
+	if err == nil {
+		t.Fatal("createPost() succeeded, want a timeout")
+	}
+	if atomic.LoadInt32(&attempts) != 1 {
+		t.Fatalf("sent %v create post requests after a timeout, want 1", atomic.LoadInt32(&attempts))
+	}
+}
+
+func TestMediumClientRetriesPostThatNeverConnected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	_, _, err = testMediumClient("http://"+address).createPost(context.Background(), "user1", createPostRequest{Title: "title"})
+	if err == nil || !isRetryable(err, false) {
+		t.Fatalf("createPost() = %v, want a dial error that is retryable", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("120"); got != 2*time.Minute {
+		t.Fatalf("parseRetryAfter(120) = %v, want 2m", got)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 59*time.Minute || got > time.Hour {
+		t.Fatalf("parseRetryAfter(%s) = %v, want about an hour", date, got)
+	}
+	if got := parseRetryAfter("soon"); got != 0 {
+		t.Fatalf("parseRetryAfter(soon) = %v, want 0", got)
+	}
+}
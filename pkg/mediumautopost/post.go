@@ -0,0 +1,93 @@
+package mediumautopost
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultPublishStatus is used when MEDIUM_PUBLISH_STATUS is empty, so posts can be reviewed before they go live.
+const defaultPublishStatus = "draft"
+
+// publishStatuses and licenses are the values medium.com accepts for a post.
+var (
+	publishStatuses = map[string]bool{"draft": true, "unlisted": true, "public": true}
+	licenses        = map[string]bool{
+		"all-rights-reserved": true,
+		"cc-40-by":            true,
+		"cc-40-by-sa":         true,
+		"cc-40-by-nd":         true,
+		"cc-40-by-nc":         true,
+		"cc-40-by-nc-nd":      true,
+		"cc-40-by-nc-sa":      true,
+		"cc-40-zero":          true,
+		"public-domain":       true,
+	}
+)
+
+// createPostRequest is the body of a create post request.
+type createPostRequest struct {
+	Title           string   `json:"title"`
+	ContentFormat   string   `json:"contentFormat"`
+	Content         string   `json:"content"`
+	CanonicalURL    string   `json:"canonicalUrl,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	PublishStatus   string   `json:"publishStatus,omitempty"`
+	License         string   `json:"license,omitempty"`
+	PublishedAt     string   `json:"publishedAt,omitempty"`
+	NotifyFollowers bool     `json:"notifyFollowers"`
+}
+
+// newCreatePostRequest builds the request for an article from the config's defaults and the article's overrides.
+func newCreatePostRequest(c Config, article ArticleJSONData) (createPostRequest, error) {
+	request := createPostRequest{
+		Title:           article.Title,
+		ContentFormat:   article.ContentFormat,
+		Content:         article.Content,
+		CanonicalURL:    article.CanonicalURL,
+		Tags:            article.Tags,
+		PublishStatus:   c.MediumPublishStatus,
+		License:         c.MediumLicense,
+		NotifyFollowers: c.MediumNotifyFollowers,
+	}
+	if request.PublishStatus == "" {
+		request.PublishStatus = defaultPublishStatus
+	}
+	if article.PublishStatus != "" {
+		request.PublishStatus = strings.ToLower(article.PublishStatus)
+	}
+	if article.License != "" {
+		request.License = strings.ToLower(article.License)
+	}
+	if article.NotifyFollowers != nil {
+		request.NotifyFollowers = *article.NotifyFollowers
+	}
+	err := validatePostOptions(request.PublishStatus, request.License)
+	if err != nil {
+		return request, err
+	}
+	if article.PublishedAt != "" {
+		publishedAt, err := time.Parse(time.RFC3339, article.PublishedAt)
+		if err != nil {
+			return request, fmt.Errorf("invalid publishedAt, it must be an RFC3339 date: %v", err)
+		}
+		if publishedAt.After(time.Now()) {
+			return request, fmt.Errorf("publishedAt %s is in the future, medium.com can only backdate posts", article.PublishedAt)
+		}
+		request.PublishedAt = publishedAt.UTC().Format(time.RFC3339)
+	}
+	return request, nil
+}
+
+// validatePostOptions checks a publish status and license against the values medium.com accepts.
+// an empty license means the user's default.
+func validatePostOptions(publishStatus string, license string) error {
+	if !publishStatuses[publishStatus] {
+		return fmt.Errorf("invalid publish status %q, it must be draft, unlisted or public", publishStatus)
+	}
+	if license != "" && !licenses[license] {
+		return fmt.Errorf("invalid license %q, it must be one of all-rights-reserved, cc-40-by, cc-40-by-sa, cc-40-by-nd, "+
+			"cc-40-by-nc, cc-40-by-nc-nd, cc-40-by-nc-sa, cc-40-zero or public-domain", license)
+	}
+	return nil
+}
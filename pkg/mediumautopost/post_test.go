@@ -0,0 +1,93 @@
+package mediumautopost
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCreatePostRequest(t *testing.T) {
+	yes, no := true, false
+	article := ArticleJSONData{Title: "One", ContentFormat: "markdown", Content: "one", CanonicalURL: "https://example.com/one/", Tags: []string{"go"}}
+	with := func(change func(*ArticleJSONData)) ArticleJSONData {
+		a := article
+		change(&a)
+		return a
+	}
+	defaults := Config{MediumPublishStatus: "public", MediumLicense: "cc-40-by", MediumNotifyFollowers: true}
+	tests := []struct {
+		name    string
+		config  Config
+		article ArticleJSONData
+		want    createPostRequest
+		err     string
+	}{
+		{name: "config defaults", config: defaults, article: article,
+			want: createPostRequest{PublishStatus: "public", License: "cc-40-by", NotifyFollowers: true}},
+		{name: "empty config", article: article, want: createPostRequest{PublishStatus: defaultPublishStatus}},
+		{name: "publish status override", config: defaults, article: with(func(a *ArticleJSONData) { a.PublishStatus = "Unlisted" }),
+			want: createPostRequest{PublishStatus: "unlisted", License: "cc-40-by", NotifyFollowers: true}},
+		{name: "license override", config: defaults, article: with(func(a *ArticleJSONData) { a.License = "PUBLIC-DOMAIN" }),
+			want: createPostRequest{PublishStatus: "public", License: "public-domain", NotifyFollowers: true}},
+		{name: "notify followers off", config: defaults, article: with(func(a *ArticleJSONData) { a.NotifyFollowers = &no }),
+			want: createPostRequest{PublishStatus: "public", License: "cc-40-by"}},
+		{name: "notify followers on", article: with(func(a *ArticleJSONData) { a.NotifyFollowers = &yes }),
+			want: createPostRequest{PublishStatus: defaultPublishStatus, NotifyFollowers: true}},
+		{name: "published at", config: defaults, article: with(func(a *ArticleJSONData) { a.PublishedAt = "2020-01-02T03:04:05+02:00" }),
+			want: createPostRequest{PublishStatus: "public", License: "cc-40-by", NotifyFollowers: true, PublishedAt: "2020-01-02T01:04:05Z"}},
+
+		{name: "invalid publish status override", config: defaults, article: with(func(a *ArticleJSONData) { a.PublishStatus = "published" }), err: `invalid publish status "published"`},
+		{name: "invalid configured publish status", config: Config{MediumPublishStatus: "live"}, article: article, err: `invalid publish status "live"`},
+		{name: "invalid license override", config: defaults, article: with(func(a *ArticleJSONData) { a.License = "mit" }), err: `invalid license "mit"`},
+		{name: "future published at", config: defaults, article: with(func(a *ArticleJSONData) { a.PublishedAt = time.Now().Add(time.Hour).Format(time.RFC3339) }), err: "in the future"},
+		{name: "published at without a zone", config: defaults, article: with(func(a *ArticleJSONData) { a.PublishedAt = "2020-01-02T03:04:05" }), err: "RFC3339"},
+		{name: "published at as a date", config: defaults, article: with(func(a *ArticleJSONData) { a.PublishedAt = "2020-01-02" }), err: "RFC3339"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := newCreatePostRequest(test.config, test.article)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("newCreatePostRequest() = %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the article itself is always passed on as it is
+			if request.Title != "One" || request.ContentFormat != "markdown" || request.Content != "one" ||
+				request.CanonicalURL != "https://example.com/one/" || strings.Join(request.Tags, ",") != "go" {
+				t.Fatalf("newCreatePostRequest() = %+v, want the article's title, content, url and tags", request)
+			}
+			if request.PublishStatus != test.want.PublishStatus || request.License != test.want.License ||
+				request.NotifyFollowers != test.want.NotifyFollowers || request.PublishedAt != test.want.PublishedAt {
+				t.Fatalf("newCreatePostRequest() = %+v, want %+v", request, test.want)
+			}
+		})
+	}
+}
+
+func TestValidatePostOptions(t *testing.T) {
+	tests := []struct {
+		publishStatus string
+		license       string
+		err           string
+	}{
+		{"draft", "", ""},
+		{"unlisted", "all-rights-reserved", ""},
+		{"public", "cc-40-zero", ""},
+		{"public", "public-domain", ""},
+		{"", "", "invalid publish status"},
+		{"Public", "", "invalid publish status"},
+		{"scheduled", "", "invalid publish status"},
+		{"draft", "cc-by", "invalid license"},
+		{"draft", "CC-40-BY", "invalid license"},
+	}
+	for _, test := range tests {
+		err := validatePostOptions(test.publishStatus, test.license)
+		if (test.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("validatePostOptions(%q, %q) = %v, want %q", test.publishStatus, test.license, err, test.err)
+		}
+	}
+}
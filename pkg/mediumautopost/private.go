@@ -1,155 +1,442 @@
 package mediumautopost
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Medium/medium-sdk-go"
-	"github.com/google/go-github/github"
 	"github.com/joho/godotenv"
-	"golang.org/x/oauth2"
 )
 
-// updateStatusRepository takes the updated array of published articles and commits it back to github so its up to date for the next time this runs.
-// I'm not gonna lie, this is a bit complicated. the process is outlined here: http://www.levibotelho.com/development/commit-a-file-with-the-github-api/
-// This code does those steps using go-github.
-// if STORAGE_TYPE is "file" and STORAGE_FILE_PATH is set, a local file will be used for storing the publish status.
-// otherwise github will be used to store the publish status
-func updateStatusRepository(PublishedArticles []PublishedArticle, c Config) error {
-	log.Println("updating status of posted articles for next use.")
-	filebytes, err := json.MarshalIndent(PublishedArticles, "", "  ")
-	filebytesSting := string(filebytes)
+// publish does one run against an already locked status store. it fetches the published articles (if they exist),
+// replays the journal, posts the articles that are not published yet and saves the status.
+// lockCtx is cancelled when the lock is lost, no article is posted after that.
+func publish(lockCtx context.Context, config Config, store StatusStore) error {
+	// requests to medium.com are not cancelled with the lock, a post that is being created must still be recorded
+	ctx := context.Background()
+	client, err := newHTTPClient(config)
 	if err != nil {
 		return err
 	}
 
-	if c.StorageType == File && len(c.StorageFile) > 0 {
-		err := ioutil.WriteFile(c.StorageFile, filebytes, 0644)
+	journal := newJournal(config)
+	status, err := loadStatus(store, journal)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the article index from the configured source
+	source, err := newArticleSource(config, client)
+	if err != nil {
+		return err
+	}
+	sourceName := string(sourceTypeOf(config))
+	stateful, isStateful := source.(StatefulSource)
+	if isStateful && len(status.Sources[sourceName]) > 0 {
+		err = stateful.RestoreState(status.Sources[sourceName])
 		if err != nil {
 			return err
 		}
-	} else {
-		ctx := context.Background()
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: c.GithubPersonalToken},
-		)
-		tc := oauth2.NewClient(ctx, ts)
-		client := github.NewClient(tc)
-
-		log.Println("fetching main branch")
-		branch, _, err := client.Repositories.GetBranch(ctx, c.GithubStatusRepoOwner, c.GithubStatusRepo, "main")
+	}
+	indexOfArticlesOnWebsite, err := source.Index()
+	if err != nil {
+		return err
+	}
+
+	// stores with an index only look up the articles on the website and the ones in the retry queue
+	if lookup, ok := store.(articleLookup); ok {
+		ids := []string{}
+		for _, article := range indexOfArticlesOnWebsite {
+			ids = append(ids, article.ID)
+		}
+		for _, failure := range status.Failures {
+			ids = append(ids, failure.ID)
+		}
+		status.Articles, err = lookup.lookupArticles(ids, nil)
 		if err != nil {
 			return err
 		}
+	}
+	publishedArticles := status.Articles
+
+	// Compare articles on website to list of already published articles.
+	// return only the ones that need to be published to medium.com
+	articlesThatNeedPostedToMedium := eliminateArticlesThatHaveAlreadyBeenPosted(publishedArticles, indexOfArticlesOnWebsite)
+
+	// then drop the ones the filtering rules say should not be syndicated
+	articlesThatNeedPostedToMedium = filterArticles(config, articlesThatNeedPostedToMedium)
+
+	// and the ones that failed before and wait for their next attempt
+	status.Failures = pruneFailures(status)
+	articlesThatNeedPostedToMedium = deferFailedArticles(status.Failures, articlesThatNeedPostedToMedium, time.Now())
 
-		log.Println("creating blob")
-		blob, _, err := client.Git.CreateBlob(ctx, c.GithubStatusRepoOwner, c.GithubStatusRepo, &github.Blob{
-			Content: &filebytesSting,
-		})
+	medium := newMediumClient(config)
+	config.MediumUser, err = medium.getUser(ctx)
+	if err != nil {
+		return err
+	}
+	publications := newPublicationAccess(medium, config.MediumUser.ID)
+	if config.MediumPublicationID != "" {
+		err = publications.check(ctx, config.MediumPublicationID)
 		if err != nil {
 			return err
 		}
+	}
 
-		path := "status.json"
-		mode := "100644"
-		treetype := "blob"
+	// publish the article(s), return which were successful, log the failures.
+	// each success is journaled immediately so it is not reposted if this run dies before saving.
+	// at most MAX_POSTS_PER_RUN articles are posted, the rest is left for the next runs.
+	// failures go in the retry queue in the status.
+	posted := 0
+	left := 0
+	for i, article := range articlesThatNeedPostedToMedium {
+		if lockCtx.Err() != nil {
+			left = len(articlesThatNeedPostedToMedium) - i
+			log.Printf("the lock was lost, leaving %v articles for the next run", left)
+			break
+		}
+		if config.MaxPostsPerRun > 0 && posted == config.MaxPostsPerRun {
+			left = len(articlesThatNeedPostedToMedium) - i
+			log.Printf("posted MAX_POSTS_PER_RUN (%v) articles, leaving %v for the next run", posted, left)
+			break
+		}
+		err := postArticleToMedium(ctx, config, medium, article, &publishedArticles, source, publications)
+		if err != nil {
+			log.Printf("posting error: %v", err)
+			// the next articles would fail the same way when the token is rejected or medium.com keeps rate limiting.
+			// that is not the article's fault, so it is not counted as a failed attempt of it
+			if isMediumStatus(err, http.StatusUnauthorized, http.StatusTooManyRequests) {
+				left = len(articlesThatNeedPostedToMedium) - i
+				log.Printf("stopping, leaving %v articles for the next run", left)
+				break
+			}
+			status.Failures = recordFailure(config, status.Failures, article, err, time.Now())
+			continue
+		}
+		posted++
+		status.Failures = removeFailure(status.Failures, article.ID)
+		log.Printf("successfully posted %s\n", article.URL)
+		err = journal.Record(publishedArticles[len(publishedArticles)-1])
+		if err != nil {
+			log.Printf("journal error: %v", err)
+		}
+	}
 
-		log.Println("creating tree")
-		tree, _, err := client.Git.CreateTree(ctx, c.GithubStatusRepoOwner, c.GithubStatusRepo, *branch.Commit.Commit.Tree.SHA, []github.TreeEntry{
-			{
-				Path: &path,
-				Mode: &mode,
-				Type: &treetype,
-				SHA:  blob.SHA,
-			},
-		})
+	// update the published articles list in the status store to reflect current state
+	log.Println("updating status of posted articles for next use.")
+	status.Articles = publishedArticles
+	// the source state is only moved forward when everything was posted and no article waits for a retry, otherwise
+	// the next runs could skip the articles that failed or were left because the source reports nothing changed.
+	// dead-lettered articles don't hold it back, requeueing them resets the source state instead
+	reportDeadArticles(status.Failures)
+	if isStateful && activeFailures(status.Failures) == 0 && left == 0 {
+		state, err := stateful.State()
 		if err != nil {
 			return err
 		}
+		if status.Sources == nil {
+			status.Sources = map[string]json.RawMessage{}
+		}
+		status.Sources[sourceName] = state
+	}
+	err = store.Save(status)
+	if err != nil {
+		return err
+	}
+	return journal.Clear()
+}
 
-		log.Println("creating commit")
-		message := "update the medium content"
-		newCommit, _, err := client.Git.CreateCommit(ctx, c.GithubStatusRepoOwner, c.GithubStatusRepo, &github.Commit{
-			Parents: []github.Commit{
-				{
-					SHA: branch.Commit.SHA,
-				},
-			},
-			Tree:    tree,
-			Message: &message,
-		})
+// postSingleArticle posts one article that did not come from a source, e.g. read from a file, against an already
+// locked status store and records it under the given index item. it refuses to post an ID that was already posted.
+func postSingleArticle(lockCtx context.Context, config Config, store StatusStore, item ArticleIndexItem, article ArticleJSONData) error {
+	journal := newJournal(config)
+	status, err := loadStatus(store, journal)
+	if err != nil {
+		return err
+	}
+	if lookup, ok := store.(articleLookup); ok {
+		status.Articles, err = lookup.lookupArticles([]string{item.ID}, []string{item.URL})
 		if err != nil {
 			return err
 		}
+	}
+	for _, posted := range status.Articles {
+		if posted.ID == item.ID {
+			return fmt.Errorf("article %s was already posted to medium", item.ID)
+		}
+		if item.URL != "" && posted.URL == item.URL {
+			return fmt.Errorf("%s was already posted to medium as article %s", item.URL, posted.ID)
+		}
+	}
 
-		log.Println("updating ref")
-		branchref := "refs/heads/main"
-		reference := github.Reference{
-			Object: &github.GitObject{
-				SHA: newCommit.SHA,
-			},
-			Ref: &branchref,
+	ctx := context.Background()
+	medium := newMediumClient(config)
+	config.MediumUser, err = medium.getUser(ctx)
+	if err != nil {
+		return err
+	}
+	if lockCtx.Err() != nil {
+		return errors.New("the lock was lost, not posting the article")
+	}
+	publications := newPublicationAccess(medium, config.MediumUser.ID)
+	err = postArticleToMedium(ctx, config, medium, item, &status.Articles, payloadSource{article: article}, publications)
+	if err != nil {
+		return err
+	}
+	status.Failures = removeFailure(status.Failures, item.ID)
+	log.Printf("successfully posted %s\n", item.URL)
+	err = journal.Record(status.Articles[len(status.Articles)-1])
+	if err != nil {
+		log.Printf("journal error: %v", err)
+	}
+
+	err = store.Save(status)
+	if err != nil {
+		return err
+	}
+	return journal.Clear()
+}
+
+// loadStatus loads the status and merges in the articles a previous run posted but never got to save.
+// those are saved right away. stores that implement articleLookup are loaded without their articles.
+func loadStatus(store StatusStore, journal *journal) (Status, error) {
+	load := store.Load
+	if lookup, ok := store.(articleLookup); ok {
+		load = lookup.loadState
+	}
+	status, err := load()
+	if err != nil {
+		return status, err
+	}
+	journaledArticles, err := journal.Replay()
+	if err != nil {
+		return status, err
+	}
+	if len(journaledArticles) > 0 {
+		log.Printf("found %v articles in the journal from a previous run, saving them to the status store", len(journaledArticles))
+		status.Articles = mergePublishedArticles(status.Articles, journaledArticles)
+		err = store.Save(status)
+		if err != nil {
+			return status, err
 		}
-		_, _, err = client.Git.UpdateRef(ctx, c.GithubStatusRepoOwner, c.GithubStatusRepo, &reference, false)
+		err = journal.Clear()
 		if err != nil {
-			return err
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// newHTTPClient returns the client used to fetch the articles. when the json index is read from disk (a local path or
+// a file:// url in WEBSITE_JSON_INDEX_URL) it can also read file:// urls below the directory of the index, so the
+// articles of a site that was just built are read from disk too. redirects are only followed to http(s) urls, so a
+// remote server can't point the client at a local file.
+func newHTTPClient(c Config) (http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if sourceTypeOf(c) == JSONIndex && c.WebsiteJSONIndexURL != "" {
+		indexURL, err := fileURL(c.WebsiteJSONIndexURL)
+		if err != nil {
+			return http.Client{}, err
+		}
+		if isFileURL(indexURL) {
+			u, err := url.Parse(indexURL)
+			if err != nil {
+				return http.Client{}, err
+			}
+			transport.RegisterProtocol("file", http.NewFileTransport(fileRoot(path.Dir(u.Path))))
 		}
 	}
+	return http.Client{Transport: transport, CheckRedirect: checkRedirect}, nil
+}
 
+// checkRedirect refuses redirects to anything but http and https, and stops after 10 redirects like the default.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing the redirect to %s, only http and https redirects are followed", req.URL)
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
 	return nil
 }
 
-// postArticleToMedium takes config, a single article's id and URL and an http client. using this info it fetches the
-// full article from the website in json format and posts to medium. returns error if failure. on success
-// appends to the list of published articles which is passed by reference
-func postArticleToMedium(c Config, a ArticleIndexItem, publishedArticles *[]PublishedArticle, client http.Client, mediumClient *medium.Medium) error {
-	// fetch the full article json content from site
-	resp, err := client.Get(a.URL)
+// fileRoot serves the files below a directory for file:// urls. unlike http.Dir the urls are absolute paths,
+// the directory is not prepended to them, anything outside of it is refused.
+type fileRoot string
+
+func (r fileRoot) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	root := strings.TrimSuffix(string(r), "/")
+	if name != root && !strings.HasPrefix(name, root+"/") {
+		return nil, os.ErrPermission
+	}
+	return http.Dir("/").Open(name)
+}
+
+// fileURL turns a local path into a file:// url. urls are returned unchanged.
+func fileURL(location string) (string, error) {
+	if strings.Contains(location, "://") {
+		return location, nil
+	}
+	abs, err := filepath.Abs(location)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.ToSlash(abs)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String(), nil
+}
+
+// checkLinkedURL refuses a file:// url that is linked from a document that was not read from disk itself, e.g. an
+// article url in a remote index. otherwise whoever serves the index could make the tool read and post local files.
+func checkLinkedURL(base, target string) error {
+	if isFileURL(target) && !isFileURL(base) {
+		return fmt.Errorf("%s links to the local file %s, only local documents can link to local files", base, target)
+	}
+	return nil
+}
+
+func isFileURL(location string) bool {
+	u, err := url.Parse(strings.TrimSpace(location))
+	return err == nil && strings.EqualFold(u.Scheme, "file")
+}
+
+// payloadSource is the source of an article that was given directly, see postSingleArticle.
+type payloadSource struct {
+	article ArticleJSONData
+}
+
+func (s payloadSource) Index() ([]ArticleIndexItem, error) {
+	return []ArticleIndexItem{}, nil
+}
+
+func (s payloadSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	return s.article, nil
+}
+
+// copyStatus loads the status from source, merges it into destination and saves it. reopen returns a fresh
+// instance of the destination store which is used to read the result back and verify the counts and IDs.
+func copyStatus(source StatusStore, destination StatusStore, reopen func() (StatusStore, error)) error {
+	sourceStatus, err := source.Load()
+	if err != nil {
+		return err
+	}
+	destinationStatus, err := destination.Load()
+	if err != nil {
+		return err
+	}
+	log.Printf("copying %v articles, the destination already has %v", len(sourceStatus.Articles), len(destinationStatus.Articles))
+	merged := mergeStatus(sourceStatus, destinationStatus)
+	err = destination.Save(merged)
 	if err != nil {
 		return err
 	}
 
-	// get the json data as a byte array
-	jsonIndexData, err := ioutil.ReadAll(resp.Body)
+	log.Println("verifying the copy")
+	verify, err := reopen()
+	if err != nil {
+		return err
+	}
+	defer closeStore(verify)
+	copied, err := verify.Load()
 	if err != nil {
 		return err
 	}
+	copiedIDs := map[string]bool{}
+	for _, article := range copied.Articles {
+		copiedIDs[article.ID] = true
+	}
+	missing := []string{}
+	for _, article := range sourceStatus.Articles {
+		if !copiedIDs[article.ID] {
+			missing = append(missing, article.ID)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("copy verification failed, %v articles are missing from the destination: %v", len(missing), missing)
+	}
+	if len(copied.Articles) != len(merged.Articles) {
+		return fmt.Errorf("copy verification failed, expected %v articles in the destination but found %v", len(merged.Articles), len(copied.Articles))
+	}
+	log.Printf("verified %v articles in the destination", len(copied.Articles))
+	return nil
+}
 
-	// unmarshal to type
-	article := ArticleJSONData{}
-	err = json.Unmarshal(jsonIndexData, &article)
+// postArticleToMedium takes config, a single article's index item and an article source. using this info it gets the
+// full article from the source and posts to medium. returns error if failure. on success
+// appends to the list of published articles which is passed by reference
+func postArticleToMedium(ctx context.Context, c Config, medium *mediumClient, a ArticleIndexItem, publishedArticles *[]PublishedArticle,
+	source ArticleSource, publications *publicationAccess) error {
+	// get the full article content from the source
+	article, err := source.Article(a)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("posting article %s to medium", article.Title)
-	// post to medium
-	result, err := mediumClient.CreatePost(medium.CreatePostOptions{
-		UserID:        c.MediumUser.ID,
-		Title:         article.Title,
-		Content:       article.Content,
-		ContentFormat: medium.ContentFormat(article.ContentFormat),
-		Tags:          article.Tags,
-		CanonicalURL:  article.CanonicalURL,
-		PublishStatus: "draft",
-	})
+	// the config's defaults and the article's overrides are validated before anything is sent
+	request, err := newCreatePostRequest(c, article)
+	if err != nil {
+		return fmt.Errorf("article %s: %v", article.Title, err)
+	}
+
+	// post to medium, into a publication if the article or the config names one
+	publicationID := article.PublicationID
+	if publicationID == "" {
+		publicationID = c.MediumPublicationID
+	}
+	var result *mediumPost
+	var response json.RawMessage
+	if publicationID != "" {
+		err = publications.check(ctx, publicationID)
+		if err != nil {
+			return err
+		}
+		log.Printf("posting article %s to medium publication %s as %s", article.Title, publicationID, request.PublishStatus)
+		result, response, err = medium.createPublicationPost(ctx, publicationID, request)
+	} else {
+		log.Printf("posting article %s to medium as %s", article.Title, request.PublishStatus)
+		result, response, err = medium.createPost(ctx, c.MediumUser.ID, request)
+	}
 	if err != nil {
-		return fmt.Errorf("error when posting article %s: %v", article.Title, err)
+		return fmt.Errorf("error when posting article %s: %w", article.Title, err)
 	}
 
 	// add successful post to the list of published articles
+	now := time.Now().UTC().Truncate(time.Second)
 	*publishedArticles = append(*publishedArticles, PublishedArticle{
-		URL:                article.CanonicalURL,
-		ID:                 a.ID,
-		PublishTimestamp:   time.Now().String(),
-		MediumPostResponse: *result,
+		URL:              article.CanonicalURL,
+		ID:               a.ID,
+		PublishTimestamp: now,
+		ContentHash:      contentHash(article),
+		Platforms: map[string]PlatformResult{
+			Medium: {
+				PostID:        result.ID,
+				URL:           result.URL,
+				Title:         result.Title,
+				PublishStatus: result.PublishState,
+				PublicationID: publicationID,
+				PublishedAt:   now,
+				Response:      response,
+			},
+		},
 	})
 
 	return nil
@@ -182,73 +469,71 @@ func eliminateArticlesThatHaveAlreadyBeenPosted(alreadyPublished []PublishedArti
 	return articlesThatNeedPostedToMedium
 }
 
-// fetchArticleIndexFromSite pulls the index from the origin website.
-// as can be seen here: https://askcloudarchitech.com/posts/index.json
-func fetchArticleIndexFromSite(c Config, client http.Client) ([]ArticleIndexItem, error) {
-	resp, err := client.Get(c.WebsiteJSONIndexURL)
-	if err != nil {
-		return []ArticleIndexItem{}, err
-	}
-	jsonIndexData, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return []ArticleIndexItem{}, err
+// contentHash identifies the content of an article so changes to it can be detected later.
+func contentHash(article ArticleJSONData) string {
+	sum := sha256.Sum256([]byte(article.Title + "\n" + article.Content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// mergePublishedArticles combines two lists of published articles by ID. everything in base is kept
+// as is and the articles from extra that are not in base are appended.
+func mergePublishedArticles(base []PublishedArticle, extra []PublishedArticle) []PublishedArticle {
+	merged := append([]PublishedArticle{}, base...)
+	seen := map[string]bool{}
+	for _, article := range base {
+		seen[article.ID] = true
 	}
-	indexOfArticlesOnWebsite := []ArticleIndexItem{}
-	json.Unmarshal(jsonIndexData, &indexOfArticlesOnWebsite)
-	if err != nil {
-		return []ArticleIndexItem{}, err
+	for _, article := range extra {
+		if !seen[article.ID] {
+			seen[article.ID] = true
+			merged = append(merged, article)
+		}
 	}
-	log.Printf("found index containing a total of %v articles", len(indexOfArticlesOnWebsite))
-	return indexOfArticlesOnWebsite, nil
+	return merged
 }
 
-// fetchPublishedArticles fetches a json file from the github repo or from file which stores the status of which articles
-// have been already published to medium.com
-// if STORAGE_TYPE is "file" and STORAGE_FILE_PATH is set, a local file will be used for storing the publish status.
-// otherwise github will be used to store the publish status
-func fetchPublishedArticles(c Config) ([]PublishedArticle, error) {
-	publishedArticles := []PublishedArticle{}
-	var filedata []byte
-	var err error
-	if c.StorageType == File && len(c.StorageFile) > 0 {
-		log.Println("FILE storage type detected. Using local file for status storage")
-		filedata, err = ioutil.ReadFile(c.StorageFile)
-		if err != nil {
-			return publishedArticles, err
-		}
-	} else {
-		ctx := context.Background()
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: c.GithubPersonalToken},
-		)
-		tc := oauth2.NewClient(ctx, ts)
-
-		client := github.NewClient(tc)
-		gitoptions := github.RepositoryContentGetOptions{
-			Ref: "main",
-		}
-		log.Println("Pulling list of already published articles")
-		rc, err := client.Repositories.DownloadContents(ctx, c.GithubStatusRepoOwner, c.GithubStatusRepo, "status.json", &gitoptions)
-		if err != nil && strings.Contains(err.Error(), "No file named") {
-			log.Println("no status.json file found. starting from scratch")
-			return publishedArticles, nil
+// mergeStatus combines a status read back from the store with the one this run is about to save.
+// articles are merged by ID, see mergePublishedArticles.
+func mergeStatus(base Status, extra Status) Status {
+	merged := base
+	merged.Articles = mergePublishedArticles(base.Articles, extra.Articles)
+	// source state is only a cache, the newer state in extra wins
+	if len(extra.Sources) > 0 {
+		merged.Sources = map[string]json.RawMessage{}
+		for name, state := range base.Sources {
+			merged.Sources[name] = state
 		}
-		if err != nil {
-			return publishedArticles, err
+		for name, state := range extra.Sources {
+			merged.Sources[name] = state
 		}
-		defer rc.Close()
-		filedata, err = ioutil.ReadAll(rc)
-		if err != nil {
-			return publishedArticles, err
+	}
+	// so do the failures in extra, and the failures of articles that are posted now are dropped
+	merged.Failures = append([]FailedArticle{}, extra.Failures...)
+	for _, failure := range base.Failures {
+		if findFailure(merged.Failures, failure.ID) < 0 {
+			merged.Failures = append(merged.Failures, failure)
 		}
 	}
+	merged.Failures = pruneFailures(merged)
+	return merged
+}
 
-	log.Println("unmarshaling status.json")
-	err = json.Unmarshal(filedata, &publishedArticles)
-	if err != nil {
-		return publishedArticles, err
+// maxBackoff caps the wait of backoff, so it can't overflow however many attempts were made.
+const maxBackoff = 30 * 24 * time.Hour
+
+// backoff returns how long to wait before the given retry attempt (starting at 1).
+// the wait doubles with every attempt, up to maxBackoff, and a random jitter of up to half the wait is added
+// so runs that failed at the same time don't retry at the same time.
+func backoff(attempt int, base time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
 	}
-	return publishedArticles, nil
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	jitter := rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(int64(wait)/2 + 1)
+	return wait + time.Duration(jitter)
 }
 
 // getconfig reads in an environment variable file then populates the config with the necessary values
@@ -267,21 +552,207 @@ func getconfig(filename string) (Config, error) {
 	config := Config{
 		MediumEndpointPrefix:  os.Getenv("MEDIUM_ENDPOINT_PREFIX"),
 		MediumBearerToken:     os.Getenv("MEDIUM_BEARER_TOKEN"),
+		MediumPublicationID:   os.Getenv("MEDIUM_PUBLICATION_ID"),
+		MediumPublishStatus:   strings.ToLower(os.Getenv("MEDIUM_PUBLISH_STATUS")),
+		MediumLicense:         strings.ToLower(os.Getenv("MEDIUM_LICENSE")),
 		WebsiteJSONIndexURL:   os.Getenv("WEBSITE_JSON_INDEX_URL"),
 		GithubPersonalToken:   os.Getenv("GITHUB_PERSONAL_TOKEN"),
 		GithubStatusRepoOwner: os.Getenv("GITHUB_STATUS_REPO_OWNER"),
 		GithubStatusRepo:      os.Getenv("GITHUB_STATUS_REPO"),
+		GithubStatusBranch:    os.Getenv("GITHUB_STATUS_BRANCH"),
+		GithubStatusPath:      os.Getenv("GITHUB_STATUS_PATH"),
+		GithubCommitMessage:   os.Getenv("GITHUB_COMMIT_MESSAGE"),
+		GithubCommitterName:   os.Getenv("GITHUB_COMMITTER_NAME"),
+		GithubCommitterEmail:  os.Getenv("GITHUB_COMMITTER_EMAIL"),
 		StorageFile:           os.Getenv("STORAGE_FILE_PATH"),
+		SQLitePath:            os.Getenv("SQLITE_PATH"),
+		S3Endpoint:            os.Getenv("S3_ENDPOINT"),
+		S3Region:              os.Getenv("S3_REGION"),
+		S3Bucket:              os.Getenv("S3_BUCKET"),
+		S3Key:                 os.Getenv("S3_KEY"),
+		S3AccessKeyID:         os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:     os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3SessionToken:        os.Getenv("S3_SESSION_TOKEN"),
+		GitlabBaseURL:         os.Getenv("GITLAB_BASE_URL"),
+		GitlabProject:         os.Getenv("GITLAB_PROJECT"),
+		GitlabBranch:          os.Getenv("GITLAB_BRANCH"),
+		GitlabToken:           os.Getenv("GITLAB_TOKEN"),
+		GiteaBaseURL:          os.Getenv("GITEA_BASE_URL"),
+		GiteaRepoOwner:        os.Getenv("GITEA_REPO_OWNER"),
+		GiteaRepo:             os.Getenv("GITEA_REPO"),
+		GiteaBranch:           os.Getenv("GITEA_BRANCH"),
+		GiteaToken:            os.Getenv("GITEA_TOKEN"),
+		JournalPath:           os.Getenv("JOURNAL_PATH"),
+		SourceType:            SourceType(strings.ToUpper(os.Getenv("SOURCE_TYPE"))),
+		FeedURL:               os.Getenv("FEED_URL"),
+		ContentDir:            os.Getenv("CONTENT_DIR"),
+		SiteBaseURL:           os.Getenv("SITE_BASE_URL"),
+		WordpressURL:          os.Getenv("WORDPRESS_URL"),
+		WordpressUsername:     os.Getenv("WORDPRESS_USERNAME"),
+		WordpressAppPassword:  os.Getenv("WORDPRESS_APP_PASSWORD"),
+		GhostURL:              os.Getenv("GHOST_URL"),
+		GhostContentAPIKey:    os.Getenv("GHOST_CONTENT_API_KEY"),
+		SitemapURL:            os.Getenv("SITEMAP_URL"),
+		SitemapPathPattern:    os.Getenv("SITEMAP_PATH_PATTERN"),
+		IncludeSections:       splitList(os.Getenv("INCLUDE_SECTIONS")),
+		ExcludeSections:       splitList(os.Getenv("EXCLUDE_SECTIONS")),
+		IncludeTags:           splitList(os.Getenv("INCLUDE_TAGS")),
+		ExcludeTags:           splitList(os.Getenv("EXCLUDE_TAGS")),
+		IncludeLangs:          splitList(os.Getenv("INCLUDE_LANGS")),
+	}
+	// fall back to the standard AWS variables so CI credentials work without renaming them
+	if config.S3AccessKeyID == "" && config.S3SecretAccessKey == "" {
+		config.S3AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		config.S3SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		config.S3SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if config.S3Region == "" {
+		config.S3Region = os.Getenv("AWS_REGION")
+	}
+	if lockTTL := os.Getenv("LOCK_TTL"); lockTTL != "" {
+		ttl, err := time.ParseDuration(lockTTL)
+		if err != nil || ttl < minLockTTL {
+			return Config{}, fmt.Errorf("invalid LOCK_TTL %q, it must be a duration such as 30m, at least %v", lockTTL, minLockTTL)
+		}
+		config.LockTTL = ttl
+	}
+	if since := os.Getenv("SINCE"); since != "" {
+		cutoff, err := parseLooseTime(since)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SINCE: %v", err)
+		}
+		config.Since = cutoff
+	}
+	if config.MediumPublishStatus == "" {
+		config.MediumPublishStatus = defaultPublishStatus
+	}
+	err := validatePostOptions(config.MediumPublishStatus, config.MediumLicense)
+	if err != nil {
+		return Config{}, err
+	}
+	if notify := os.Getenv("MEDIUM_NOTIFY_FOLLOWERS"); notify != "" {
+		config.MediumNotifyFollowers, err = strconv.ParseBool(notify)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid MEDIUM_NOTIFY_FOLLOWERS: %v", err)
+		}
+	}
+	config.MediumMaxRetries = defaultMediumRetries
+	if retries := os.Getenv("MEDIUM_MAX_RETRIES"); retries != "" {
+		config.MediumMaxRetries, err = strconv.Atoi(retries)
+		if err != nil || config.MediumMaxRetries < 0 {
+			return Config{}, fmt.Errorf("invalid MEDIUM_MAX_RETRIES %q, it must be a number of retries", retries)
+		}
+	}
+	if limit := os.Getenv("MAX_POSTS_PER_RUN"); limit != "" {
+		config.MaxPostsPerRun, err = strconv.Atoi(limit)
+		if err != nil || config.MaxPostsPerRun < 0 {
+			return Config{}, fmt.Errorf("invalid MAX_POSTS_PER_RUN %q, it must be a number of posts", limit)
+		}
+	}
+	config.RetryMaxAttempts = defaultRetryMaxAttempts
+	if attempts := os.Getenv("RETRY_MAX_ATTEMPTS"); attempts != "" {
+		config.RetryMaxAttempts, err = strconv.Atoi(attempts)
+		if err != nil || config.RetryMaxAttempts < 1 {
+			return Config{}, fmt.Errorf("invalid RETRY_MAX_ATTEMPTS %q, it must be a number of attempts", attempts)
+		}
+	}
+	config.RetryDelay = defaultRetryDelay
+	if delay := os.Getenv("RETRY_DELAY"); delay != "" {
+		config.RetryDelay, err = time.ParseDuration(delay)
+		if err != nil || config.RetryDelay <= 0 || config.RetryDelay > maxBackoff {
+			return Config{}, fmt.Errorf("invalid RETRY_DELAY %q, it must be a duration such as 1h, at most %v", delay, maxBackoff)
+		}
 	}
 	if config.MediumEndpointPrefix == "" {
 		config.MediumEndpointPrefix = "https://api.medium.com/v1"
 	}
-	switch os.Getenv("STORAGE_TYPE") {
-	case "FILE":
-		config.StorageType = File
-	default:
+	config.StorageType = StorageType(strings.ToUpper(os.Getenv("STORAGE_TYPE")))
+	if config.StorageType == "" {
 		config.StorageType = Github
 	}
 
 	return config, nil
 }
+
+// fetchURL gets the body of a url, failing on any non 2xx status.
+func fetchURL(client http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, &apiError{Method: http.MethodGet, URL: url, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return body, nil
+}
+
+// apiError is returned by doJSON when an API answers with a non 2xx status.
+type apiError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// isStatus reports whether err is an apiError with one of the given status codes.
+func isStatus(err error, codes ...int) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// doJSON sends in (if not nil) as a json body to a REST API and decodes the json response into out (if not nil).
+// the headers are added to the request, typically to authenticate.
+func doJSON(client http.Client, method, url string, headers map[string]string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return &apiError{Method: method, URL: url, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	if out != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
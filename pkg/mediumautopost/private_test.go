@@ -0,0 +1,326 @@
+package mediumautopost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSite serves a json index of articles and their payloads, like a hugo site set up as in the README.
+func testSite(t *testing.T, ids ...string) *httptest.Server {
+	t.Helper()
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.json" {
+			items := []ArticleIndexItem{}
+			for _, id := range ids {
+				items = append(items, ArticleIndexItem{URL: site.URL + "/posts/" + id + ".json", ID: id})
+			}
+			json.NewEncoder(w).Encode(items)
+			return
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/posts/"), ".json")
+		json.NewEncoder(w).Encode(ArticleJSONData{
+			Title:         "Article " + id,
+			ContentFormat: "markdown",
+			Content:       "content of " + id,
+			CanonicalURL:  site.URL + "/posts/" + id + "/",
+		})
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+// testMedium is a stand-in for the medium.com API. posts are answered by respond, or created when it is nil.
+type testMedium struct {
+	*httptest.Server
+	mu      sync.Mutex
+	posts   []createPostRequest
+	respond func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newTestMedium(t *testing.T) *testMedium {
+	t.Helper()
+	m := &testMedium{}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/me" {
+			fmt.Fprint(w, `{"data":{"id":"user1","username":"tester"}}`)
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.respond != nil && m.respond(w, r) {
+			return
+		}
+		request := createPostRequest{}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		m.posts = append(m.posts, request)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"data":{"id":"post%d","title":%q,"url":"https://medium.com/p/%d","publishStatus":%q}}`,
+			len(m.posts), request.Title, len(m.posts), request.PublishStatus)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *testMedium) postCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.posts)
+}
+
+func testConfig(t *testing.T, site *httptest.Server, medium *testMedium) Config {
+	return Config{
+		MediumEndpointPrefix: medium.URL,
+		MediumBearerToken:    "token",
+		MediumPublishStatus:  defaultPublishStatus,
+		WebsiteJSONIndexURL:  site.URL + "/index.json",
+		JournalPath:          filepath.Join(t.TempDir(), "journal.jsonl"),
+		RetryMaxAttempts:     defaultRetryMaxAttempts,
+		RetryDelay:           defaultRetryDelay,
+	}
+}
+
+func TestPublish(t *testing.T) {
+	site := testSite(t, "one", "two")
+	medium := newTestMedium(t)
+	config := testConfig(t, site, medium)
+	store := &memoryStore{}
+
+	err := publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if medium.postCount() != 2 {
+		t.Fatalf("posted %v articles, want 2", medium.postCount())
+	}
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Articles) != 2 || status.Articles[0].ID != "one" || status.Articles[1].ID != "two" {
+		t.Fatalf("status articles = %+v, want one and two", status.Articles)
+	}
+	result := status.Articles[0].Platforms[Medium]
+	if result.PostID != "post1" || result.PublishStatus != "draft" {
+		t.Fatalf("medium result = %+v", result)
+	}
+
+	// a second run finds nothing new to post
+	err = publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if medium.postCount() != 2 {
+		t.Fatalf("second run posted again, %v posts in total", medium.postCount())
+	}
+}
+
+func TestPublishReplaysJournal(t *testing.T) {
+	site := testSite(t, "one", "two")
+	medium := newTestMedium(t)
+	config := testConfig(t, site, medium)
+	store := &memoryStore{}
+
+	// a previous run posted "one" and died before saving the status
+	journal := newJournal(config)
+	err := journal.Record(PublishedArticle{ID: "one", URL: site.URL + "/posts/one/", PublishTimestamp: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if medium.postCount() != 1 || medium.posts[0].Title != "Article two" {
+		t.Fatalf("posts = %+v, want only Article two", medium.posts)
+	}
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Articles) != 2 {
+		t.Fatalf("status has %v articles, want 2", len(status.Articles))
+	}
+	replayed, err := journal.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 0 {
+		t.Fatalf("journal still has %v articles after the status was saved", len(replayed))
+	}
+}
+
+func TestJournalIgnoresPartialLine(t *testing.T) {
+	journal := &journal{path: filepath.Join(t.TempDir(), "journal.jsonl")}
+	err := journal.Record(PublishedArticle{ID: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(journal.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(journal.path, append(data, []byte(`{"id":"tw`)...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	articles, err := journal.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].ID != "one" {
+		t.Fatalf("Replay() = %+v, want only article one", articles)
+	}
+}
+
+func TestEliminateArticlesThatHaveAlreadyBeenPosted(t *testing.T) {
+	published := []PublishedArticle{{ID: "one"}, {ID: "three"}}
+	index := []ArticleIndexItem{{ID: "one"}, {ID: "two"}, {ID: ""}, {ID: "three"}, {ID: "four"}}
+
+	got := eliminateArticlesThatHaveAlreadyBeenPosted(published, index)
+	if len(got) != 2 || got[0].ID != "two" || got[1].ID != "four" {
+		t.Fatalf("eliminateArticlesThatHaveAlreadyBeenPosted() = %+v, want two and four", got)
+	}
+}
+
+func TestPublishStopsOnRejectedToken(t *testing.T) {
+	site := testSite(t, "one", "two", "three")
+	medium := newTestMedium(t)
+	attempts := 0
+	medium.respond = func(w http.ResponseWriter, r *http.Request) bool {
+		attempts++
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"errors":[{"message":"Token was invalid.","code":6003}]}`)
+		return true
+	}
+	config := testConfig(t, site, medium)
+	store := &memoryStore{}
+
+	err := publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 {
+		t.Fatalf("medium.com was asked to create %v posts, want the run to stop after the first 401", attempts)
+	}
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Failures) != 0 {
+		t.Fatalf("failures = %+v, a rejected token must not count against the article", status.Failures)
+	}
+}
+
+func TestPostArticleToMediumWrapsMediumError(t *testing.T) {
+	medium := newTestMedium(t)
+	medium.respond = func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return true
+	}
+	config := Config{MediumEndpointPrefix: medium.URL, MediumPublishStatus: defaultPublishStatus, MediumUser: &MediumUser{ID: "user1"}}
+	client := newMediumClient(config)
+	article := ArticleJSONData{Title: "title", ContentFormat: "html", Content: "content"}
+
+	err := postArticleToMedium(context.Background(), config, client, ArticleIndexItem{ID: "one"}, &[]PublishedArticle{},
+		payloadSource{article: article}, newPublicationAccess(client, "user1"))
+	if !isMediumStatus(err, http.StatusTooManyRequests) {
+		t.Fatalf("postArticleToMedium() = %v, want a wrapped 429 MediumError", err)
+	}
+}
+
+func testHTTPClient(t *testing.T, c Config) http.Client {
+	t.Helper()
+	client, err := newHTTPClient(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestHTTPClientRefusesRedirectToFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret.txt")
+	err := ioutil.WriteFile(secret, []byte("secret"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, fileURLOf(t, secret), http.StatusFound)
+	}))
+	defer server.Close()
+
+	// even with a local index, whose directory holds the file, a remote redirect must not read it
+	for _, indexURL := range []string{server.URL + "/index.json", filepath.Join(dir, "index.json")} {
+		client := testHTTPClient(t, Config{WebsiteJSONIndexURL: indexURL})
+		data, err := fetchURL(client, server.URL+"/posts/one.json")
+		if err == nil {
+			t.Fatalf("fetchURL() with index %s = %q, want the redirect to the local file refused", indexURL, data)
+		}
+	}
+}
+
+func TestHTTPClientReadsFilesBelowTheIndexOnly(t *testing.T) {
+	dir := t.TempDir()
+	site := filepath.Join(dir, "public")
+	err := os.MkdirAll(site, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{filepath.Join(site, "post.json"): "post", filepath.Join(dir, "secret.txt"): "secret"} {
+		err = ioutil.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := testHTTPClient(t, Config{WebsiteJSONIndexURL: filepath.Join(site, "index.json")})
+	data, err := fetchURL(client, fileURLOf(t, filepath.Join(site, "post.json")))
+	if err != nil || string(data) != "post" {
+		t.Fatalf("fetchURL() of a file next to the index = %q, %v", data, err)
+	}
+	if data, err := fetchURL(client, fileURLOf(t, filepath.Join(dir, "secret.txt"))); err == nil {
+		t.Fatalf("fetchURL() of a file outside of the index directory = %q, want an error", data)
+	}
+
+	// a remote index or another source can't read local files at all
+	for _, c := range []Config{{WebsiteJSONIndexURL: "https://example.com/index.json"}, {SourceType: Feed, WebsiteJSONIndexURL: filepath.Join(site, "index.json")}} {
+		client := testHTTPClient(t, c)
+		if data, err := fetchURL(client, fileURLOf(t, filepath.Join(site, "post.json"))); err == nil {
+			t.Fatalf("fetchURL() of a local file with %+v = %q, want an error", c, data)
+		}
+	}
+}
+
+func TestPostSingleArticleRefusesPostedArticles(t *testing.T) {
+	site := testSite(t)
+	medium := newTestMedium(t)
+	config := testConfig(t, site, medium)
+	store := &memoryStore{}
+	err := store.Save(Status{Articles: []PublishedArticle{{ID: "one", URL: "https://example.com/one/"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := ArticleJSONData{Title: "One", ContentFormat: "html", Content: "<p>one</p>"}
+	for _, item := range []ArticleIndexItem{{ID: "one", URL: "https://example.com/other/"}, {ID: "other", URL: "https://example.com/one/"}} {
+		err = postSingleArticle(context.Background(), config, store, item, article)
+		if err == nil {
+			t.Fatalf("postSingleArticle(%+v) succeeded, want it refused", item)
+		}
+	}
+	if medium.postCount() != 0 {
+		t.Fatalf("posted %v articles, want none", medium.postCount())
+	}
+}
@@ -1,47 +1,107 @@
 package mediumautopost
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
-
-	"github.com/Medium/medium-sdk-go"
+	"strings"
+	"time"
 )
 
 // Config is configuration found in .env
 type Config struct {
 	StorageType           StorageType
 	StorageFile           string
+	SQLitePath            string
+	S3Endpoint            string
+	S3Region              string
+	S3Bucket              string
+	S3Key                 string
+	S3AccessKeyID         string
+	S3SecretAccessKey     string
+	S3SessionToken        string
+	GitlabBaseURL         string
+	GitlabProject         string
+	GitlabBranch          string
+	GitlabToken           string
+	GiteaBaseURL          string
+	GiteaRepoOwner        string
+	GiteaRepo             string
+	GiteaBranch           string
+	GiteaToken            string
+	JournalPath           string
+	LockTTL               time.Duration
+	SourceType            SourceType
+	FeedURL               string
+	ContentDir            string
+	SiteBaseURL           string
+	WordpressURL          string
+	WordpressUsername     string
+	WordpressAppPassword  string
+	GhostURL              string
+	GhostContentAPIKey    string
+	SitemapURL            string
+	SitemapPathPattern    string
+	IncludeSections       []string
+	ExcludeSections       []string
+	IncludeTags           []string
+	ExcludeTags           []string
+	IncludeLangs          []string
+	Since                 time.Time
 	MediumEndpointPrefix  string
 	MediumBearerToken     string
+	MediumPublicationID   string
+	MediumPublishStatus   string
+	MediumLicense         string
+	MediumNotifyFollowers bool
+	MediumMaxRetries      int
+	MaxPostsPerRun        int
+	RetryMaxAttempts      int
+	RetryDelay            time.Duration
 	WebsiteJSONIndexURL   string
 	GithubPersonalToken   string
 	GithubStatusRepoOwner string
 	GithubStatusRepo      string
-	MediumUser            *medium.User
+	GithubStatusBranch    string
+	GithubStatusPath      string
+	GithubCommitMessage   string
+	GithubCommitterName   string
+	GithubCommitterEmail  string
+	MediumUser            *MediumUser
 }
 
-type StorageType int
+// StorageType is the name a status store backend is registered under. It is set with STORAGE_TYPE.
+type StorageType string
 
 const (
-	File StorageType = iota
-	Github
+	File   StorageType = "FILE"
+	Github StorageType = "GITHUB"
 )
 
-// PublishedArticle is a record of how and when an article was published to medium.com.
+// PublishedArticle is a record of how and when an article was published to medium.com (and other platforms).
 // Can be seen here: https://github.com/askcloudarchitech/medium-publish-status
 type PublishedArticle struct {
-	URL                string      `json:"url"`
-	ID                 string      `json:"id"`
-	PublishTimestamp   string      `json:"publishTimestamp"`
-	MediumPostResponse medium.Post `json:"mediumResponse"`
+	URL              string    `json:"url"`
+	ID               string    `json:"id"`
+	PublishTimestamp time.Time `json:"publishTimestamp"`
+	// ContentHash is the sha256 of the title and content that were posted
+	ContentHash string                    `json:"contentHash,omitempty"`
+	Platforms   map[string]PlatformResult `json:"platforms"`
 }
 
 // ArticleIndexItem represents one item in the article index produced by the website.
 // Can be seen here: https://askcloudarchitech.com/posts/index.json
+// Only URL and ID are required, the other fields are used by the filtering rules when they are set.
 type ArticleIndexItem struct {
-	URL string `json:"url"`
-	ID  string `json:"id"`
+	URL       string   `json:"url"`
+	ID        string   `json:"id"`
+	Date      string   `json:"date,omitempty"`
+	Section   string   `json:"section,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Draft     bool     `json:"draft,omitempty"`
+	Lang      string   `json:"lang,omitempty"`
+	Syndicate *bool    `json:"syndicate,omitempty"`
 }
 
 //ArticleJSONData is the JSON data needed for posting an article to medium.com
@@ -51,55 +111,130 @@ type ArticleJSONData struct {
 	Content       string   `json:"content"`
 	CanonicalURL  string   `json:"canonicalUrl"`
 	Tags          []string `json:"tags"`
+	// PublicationID posts this article to a medium.com publication, overriding MEDIUM_PUBLICATION_ID
+	PublicationID string `json:"publicationId,omitempty"`
+	// PublishStatus, License and NotifyFollowers override MEDIUM_PUBLISH_STATUS, MEDIUM_LICENSE and
+	// MEDIUM_NOTIFY_FOLLOWERS for this article. PublishedAt (RFC3339, in the past) backdates the post.
+	PublishStatus   string `json:"publishStatus,omitempty"`
+	License         string `json:"license,omitempty"`
+	NotifyFollowers *bool  `json:"notifyFollowers,omitempty"`
+	PublishedAt     string `json:"publishedAt,omitempty"`
 }
 
+// Do runs the whole process once: it locks the status store, fetches the articles from the website,
+// posts the ones that are not published yet to medium.com and records them in the status store.
 func Do(dotEnvPath string) {
-	client := http.Client{}
-
 	// Populate the config struct
 	config, err := getconfig(dotEnvPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Fetch the published articles (if they exist)
-	publishedArticles, err := fetchPublishedArticles(config)
+	// the lock is released before exiting, even when publishing fails
+	err = withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+		return publish(ctx, config, store)
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Fetch the article index from the specified website
-	indexOfArticlesOnWebsite, err := fetchArticleIndexFromSite(config, client)
+	// return great success
+	fmt.Println("Great Success!")
+}
+
+// PostArticle posts a single article payload to medium.com without going through an article source, and records
+// it in the status store under the given id so later runs don't post it again. An empty id defaults to the
+// article's canonical url.
+func PostArticle(dotEnvPath string, article ArticleJSONData, id string) error {
+	config, err := getconfig(dotEnvPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if id == "" {
+		id = article.CanonicalURL
+	}
+	if id == "" {
+		return errors.New("the article has no canonicalUrl, give it an id to record it under")
+	}
+	if article.Title == "" || article.Content == "" {
+		return errors.New("the article needs a title and content")
 	}
 
-	// Compare articles on website to list of already published articles.
-	// return only the ones that need to be published to medium.com
-	articlesThatNeedPostedToMedium := eliminateArticlesThatHaveAlreadyBeenPosted(publishedArticles, indexOfArticlesOnWebsite)
+	return withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+		return postSingleArticle(ctx, config, store, ArticleIndexItem{URL: article.CanonicalURL, ID: id}, article)
+	})
+}
 
-	mediumClient := medium.NewClientWithAccessToken(config.MediumBearerToken)
-	config.MediumUser, err = mediumClient.GetUser("")
+// RetryArticle requeues an article from the retry queue, for example one that was dead-lettered after too many
+// failed attempts, so the next run posts it again.
+func RetryArticle(dotEnvPath string, id string) error {
+	config, err := getconfig(dotEnvPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// publish the article(s), return which were successful, log the failures
-	for _, article := range articlesThatNeedPostedToMedium {
-		err := postArticleToMedium(config, article, &publishedArticles, client, mediumClient)
+	return withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+		status, err := store.Load()
 		if err != nil {
-			log.Printf("posting error: %v", err)
-		} else {
-			log.Printf("successfully posted %s\n", article.URL)
+			return err
 		}
-	}
+		status, err = requeueArticle(status, id)
+		if err != nil {
+			return err
+		}
+		return store.Save(status)
+	})
+}
 
-	// update the published articles list to github repo to reflect current state
-	err = updateStatusRepository(publishedArticles, config)
+// MigrateStatus upgrades the configured status store in place to the current schema version (see StatusVersion).
+// Older versions are read transparently on every run, this only rewrites them so they don't need to be.
+func MigrateStatus(dotEnvPath string) error {
+	config, err := getconfig(dotEnvPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// return great success
-	fmt.Println("Great Success!")
+	return withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+		status, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if status.Version == StatusVersion {
+			log.Printf("status is already at version %v, rewriting it anyway", StatusVersion)
+		} else {
+			log.Printf("migrating status of %v articles from version %v to %v", len(status.Articles), status.Version, StatusVersion)
+		}
+		return store.Save(status)
+	})
+}
+
+// CopyStatus copies every published article from one configured status store to another, for example when
+// moving from the github repo to a database. Both stores are configured from the same env file. Articles that
+// are only in the destination are kept. Afterwards the destination is read back to verify nothing is missing.
+func CopyStatus(dotEnvPath string, from StorageType, to StorageType) error {
+	config, err := getconfig(dotEnvPath)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(string(from), string(to)) {
+		return fmt.Errorf("can't copy the status from %s to itself", from)
+	}
+	source, err := NewStatusStore(from, config)
+	if err != nil {
+		return err
+	}
+	defer closeStore(source)
+	destination, err := newCopyDestination(to, config)
+	if err != nil {
+		return err
+	}
+	defer closeStore(destination)
+
+	return withLock(source, func(ctx context.Context) error {
+		return withLock(destination, func(ctx context.Context) error {
+			return copyStatus(source, destination, func() (StatusStore, error) {
+				return newCopyDestination(to, config)
+			})
+		})
+	})
 }
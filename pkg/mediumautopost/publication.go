@@ -0,0 +1,60 @@
+package mediumautopost
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// publicationRoles are the contributor roles that can submit posts to a publication.
+var publicationRoles = map[string]bool{"editor": true, "writer": true}
+
+// publicationAccess checks that the token's user can post to a publication before anything is posted to it.
+// every publication is only checked once per run.
+type publicationAccess struct {
+	client  *mediumClient
+	userID  string
+	checked map[string]error
+}
+
+func newPublicationAccess(client *mediumClient, userID string) *publicationAccess {
+	return &publicationAccess{client: client, userID: userID, checked: map[string]error{}}
+}
+
+// check returns an error unless the user is a contributor of the publication with the editor or writer role.
+func (p *publicationAccess) check(ctx context.Context, publicationID string) error {
+	if err, ok := p.checked[publicationID]; ok {
+		return err
+	}
+	err := p.checkRole(ctx, publicationID)
+	p.checked[publicationID] = err
+	return err
+}
+
+func (p *publicationAccess) checkRole(ctx context.Context, publicationID string) error {
+	publications, err := p.client.getUserPublications(ctx, p.userID)
+	if err != nil {
+		return fmt.Errorf("error when listing the publications of the medium user: %w", err)
+	}
+	name := ""
+	for _, publication := range publications {
+		if publication.ID == publicationID {
+			name = publication.Name
+			break
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("the medium user is not a member of publication %s", publicationID)
+	}
+
+	contributors, err := p.client.getPublicationContributors(ctx, publicationID)
+	if err != nil {
+		return fmt.Errorf("error when listing the contributors of publication %s: %w", name, err)
+	}
+	for _, contributor := range contributors {
+		if contributor.UserID == p.userID && publicationRoles[strings.ToLower(contributor.Role)] {
+			return nil
+		}
+	}
+	return fmt.Errorf("the medium user must be an editor or writer of publication %s to post to it", name)
+}
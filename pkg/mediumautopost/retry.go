@@ -0,0 +1,154 @@
+package mediumautopost
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// defaultRetryMaxAttempts and defaultRetryDelay are used when RETRY_MAX_ATTEMPTS and RETRY_DELAY are empty.
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryDelay       = time.Hour
+)
+
+// FailedArticle is an article that could not be posted. it is kept in the status so the next runs retry it with
+// growing delays instead of on every run, until it is posted or dead-lettered.
+type FailedArticle struct {
+	URL       string `json:"url"`
+	ID        string `json:"id"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError"`
+	// LastAttempt is when it last failed, NextAttempt is the earliest time a run posts it again
+	LastAttempt time.Time `json:"lastAttempt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	// Dead is set after RETRY_MAX_ATTEMPTS failed attempts, the article is then only retried after a requeue
+	Dead bool `json:"dead,omitempty"`
+}
+
+// findFailure returns the index of the failure with the given article ID, or -1.
+func findFailure(failures []FailedArticle, id string) int {
+	for i, failure := range failures {
+		if failure.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordFailure adds a failed attempt to the article's failure, or a new failure. the next attempt is spaced out
+// exponentially from RETRY_DELAY, after RETRY_MAX_ATTEMPTS attempts the article is dead-lettered.
+func recordFailure(c Config, failures []FailedArticle, item ArticleIndexItem, postErr error, now time.Time) []FailedArticle {
+	i := findFailure(failures, item.ID)
+	if i < 0 {
+		failures = append(failures, FailedArticle{URL: item.URL, ID: item.ID})
+		i = len(failures) - 1
+	}
+	now = now.UTC().Truncate(time.Second)
+	failure := &failures[i]
+	failure.URL = item.URL
+	failure.Attempts++
+	failure.LastError = postErr.Error()
+	failure.LastAttempt = now
+	if failure.Attempts >= c.RetryMaxAttempts {
+		failure.Dead = true
+		failure.NextAttempt = time.Time{}
+		log.Printf("article %s failed %v times, it is dead-lettered until it is requeued", item.ID, failure.Attempts)
+		return failures
+	}
+	failure.NextAttempt = now.Add(backoff(failure.Attempts, c.RetryDelay))
+	log.Printf("article %s failed %v times, it is retried after %s", item.ID, failure.Attempts, failure.NextAttempt.Format(time.RFC3339))
+	return failures
+}
+
+// removeFailure drops the failure of an article, once it was posted.
+func removeFailure(failures []FailedArticle, id string) []FailedArticle {
+	i := findFailure(failures, id)
+	if i < 0 {
+		return failures
+	}
+	return append(failures[:i], failures[i+1:]...)
+}
+
+// deferFailedArticles drops the articles that failed before and are not due for another attempt yet,
+// or are dead-lettered.
+func deferFailedArticles(failures []FailedArticle, articles []ArticleIndexItem, now time.Time) []ArticleIndexItem {
+	if len(failures) == 0 {
+		return articles
+	}
+	due := []ArticleIndexItem{}
+	waiting, dead := 0, 0
+	for _, article := range articles {
+		i := findFailure(failures, article.ID)
+		switch {
+		case i < 0:
+			due = append(due, article)
+		case failures[i].Dead:
+			dead++
+		case failures[i].NextAttempt.After(now):
+			waiting++
+		default:
+			due = append(due, article)
+		}
+	}
+	if waiting > 0 || dead > 0 {
+		log.Printf("skipping %v failed articles that are not due for a retry yet and %v dead-lettered ones", waiting, dead)
+	}
+	return due
+}
+
+// activeFailures counts the failures that are still retried, i.e. not dead-lettered.
+func activeFailures(failures []FailedArticle) int {
+	active := 0
+	for _, failure := range failures {
+		if !failure.Dead {
+			active++
+		}
+	}
+	return active
+}
+
+// reportDeadArticles logs every dead-lettered article with its last error and how to requeue it.
+func reportDeadArticles(failures []FailedArticle) {
+	for _, failure := range failures {
+		if failure.Dead {
+			log.Printf("dead-lettered article %s (%s) failed %v times, last error: %s. requeue it with: mediumautopost retry %s",
+				failure.ID, failure.URL, failure.Attempts, failure.LastError, failure.ID)
+		}
+	}
+}
+
+// pruneFailures drops the failures of articles that are posted, e.g. with the post command or by a run
+// whose journal was replayed.
+func pruneFailures(status Status) []FailedArticle {
+	if len(status.Failures) == 0 {
+		return status.Failures
+	}
+	posted := map[string]bool{}
+	for _, article := range status.Articles {
+		posted[article.ID] = true
+	}
+	failures := []FailedArticle{}
+	for _, failure := range status.Failures {
+		if !posted[failure.ID] {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// requeueArticle resets the attempts of a failed or dead-lettered article so the next run posts it. the state of the
+// sources is dropped too: incremental sources moved past a dead-lettered article and would not list it again.
+func requeueArticle(status Status, id string) (Status, error) {
+	i := findFailure(status.Failures, id)
+	if i < 0 {
+		return status, fmt.Errorf("article %s is not in the retry queue", id)
+	}
+	failure := &status.Failures[i]
+	log.Printf("requeueing article %s after %v failed attempts, last error: %s", id, failure.Attempts, failure.LastError)
+	failure.Attempts = 0
+	failure.Dead = false
+	failure.NextAttempt = time.Time{}
+	status.Sources = nil
+	return status, nil
+}
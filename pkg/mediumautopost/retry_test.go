@@ -0,0 +1,99 @@
+package mediumautopost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffIsCapped(t *testing.T) {
+	for attempt := 1; attempt <= 100; attempt++ {
+		wait := backoff(attempt, time.Hour)
+		if wait <= 0 || wait > maxBackoff+maxBackoff/2 {
+			t.Fatalf("backoff(%v, 1h) = %v, want it between 0 and %v", attempt, wait, maxBackoff+maxBackoff/2)
+		}
+	}
+	if wait := backoff(1, time.Second); wait < time.Second || wait > 1500*time.Millisecond {
+		t.Fatalf("backoff(1, 1s) = %v, want between 1s and 1.5s", wait)
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	config := Config{RetryMaxAttempts: 30, RetryDelay: time.Hour}
+	item := ArticleIndexItem{ID: "one", URL: "https://example.com/one/"}
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	failures := []FailedArticle{}
+
+	for attempt := 1; attempt <= 30; attempt++ {
+		failures = recordFailure(config, failures, item, errors.New("boom"), now)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("got %v failures, want 1", len(failures))
+	}
+	failure := failures[0]
+	if failure.Attempts != 30 || !failure.Dead || failure.LastError != "boom" || !failure.LastAttempt.Equal(now) {
+		t.Fatalf("failure = %+v, want it dead after 30 attempts", failure)
+	}
+
+	failures = recordFailure(Config{RetryMaxAttempts: 5, RetryDelay: time.Hour}, nil, item, errors.New("boom"), now)
+	if failures[0].Dead || failures[0].NextAttempt.Before(now.Add(time.Hour)) {
+		t.Fatalf("failure = %+v, want it retried after an hour", failures[0])
+	}
+	due := deferFailedArticles(failures, []ArticleIndexItem{item, {ID: "two"}}, now)
+	if len(due) != 1 || due[0].ID != "two" {
+		t.Fatalf("deferFailedArticles() = %+v, want only two", due)
+	}
+	due = deferFailedArticles(failures, []ArticleIndexItem{item}, now.Add(2*time.Hour))
+	if len(due) != 1 || due[0].ID != "one" {
+		t.Fatalf("deferFailedArticles() = %+v, want one to be due", due)
+	}
+}
+
+func TestRequeueArticle(t *testing.T) {
+	status := Status{
+		Failures: []FailedArticle{{ID: "one", Attempts: 5, Dead: true}},
+		Sources:  map[string]json.RawMessage{"GIT": json.RawMessage(`{"commit":"abc"}`)},
+	}
+	status, err := requeueArticle(status, "one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Failures[0].Dead || status.Failures[0].Attempts != 0 || status.Sources != nil {
+		t.Fatalf("status = %+v, want the failure reset and the source state dropped", status)
+	}
+	if _, err := requeueArticle(status, "two"); err == nil {
+		t.Fatal("requeueing an article that is not in the queue succeeded")
+	}
+}
+
+func TestDeadLetterDoesNotHoldBackSourceState(t *testing.T) {
+	site := testSite(t, "one", "two")
+	medium := newTestMedium(t)
+	medium.respond = func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"errors":[{"message":"bad content","code":6026}]}`)
+		return true
+	}
+	config := testConfig(t, site, medium)
+	config.RetryMaxAttempts = 1
+	store := &memoryStore{}
+
+	err := publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Failures) != 2 || activeFailures(status.Failures) != 0 {
+		t.Fatalf("failures = %+v, want two dead-lettered articles", status.Failures)
+	}
+	if len(status.Sources[string(JSONIndex)]) == 0 {
+		t.Fatal("the source state was not saved although only dead-lettered articles failed")
+	}
+}
@@ -0,0 +1,143 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StatusVersion is the version of the status document written by this version of mediumautopost.
+//
+// version 1 was a bare json array of articles with Go formatted timestamps and the medium.com response inline.
+// version 2 wraps the articles in {"version":2,"articles":[...]}, uses RFC3339 timestamps, keeps one result
+// per platform the article was posted to and a hash of the posted content.
+const StatusVersion = 2
+
+// Medium is the key of the medium.com result in PublishedArticle.Platforms.
+const Medium = "medium"
+
+// Status is everything that is kept in the status store between runs.
+type Status struct {
+	// Version is the schema version the status was read as. it is always StatusVersion when written.
+	Version  int                `json:"version"`
+	Articles []PublishedArticle `json:"articles"`
+	// Sources is state kept by article sources between runs, by source type. see StatefulSource.
+	Sources map[string]json.RawMessage `json:"sources,omitempty"`
+	// Failures is the retry queue of articles that could not be posted, see FailedArticle.
+	Failures []FailedArticle `json:"failures,omitempty"`
+}
+
+// PlatformResult is the outcome of posting an article to one platform.
+type PlatformResult struct {
+	PostID        string    `json:"postId"`
+	URL           string    `json:"url"`
+	Title         string    `json:"title,omitempty"`
+	PublishStatus string    `json:"publishStatus,omitempty"`
+	PublicationID string    `json:"publicationId,omitempty"`
+	PublishedAt   time.Time `json:"publishedAt"`
+	// Response is the raw response of the platform's API, kept for reference
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// publishedArticleV1 is how articles were stored in version 1 of the status.
+type publishedArticleV1 struct {
+	URL                string     `json:"url"`
+	ID                 string     `json:"id"`
+	PublishTimestamp   string     `json:"publishTimestamp"`
+	MediumPostResponse mediumPost `json:"mediumResponse"`
+}
+
+// upgrade converts a version 1 article to the current format.
+func (a publishedArticleV1) upgrade() PublishedArticle {
+	published := parseV1Timestamp(a.PublishTimestamp)
+	response, _ := json.Marshal(a.MediumPostResponse)
+	return PublishedArticle{
+		URL:              a.URL,
+		ID:               a.ID,
+		PublishTimestamp: published,
+		Platforms: map[string]PlatformResult{
+			Medium: {
+				PostID:        a.MediumPostResponse.ID,
+				URL:           a.MediumPostResponse.URL,
+				Title:         a.MediumPostResponse.Title,
+				PublishStatus: a.MediumPostResponse.PublishState,
+				PublishedAt:   published,
+				Response:      response,
+			},
+		},
+	}
+}
+
+// parseV1Timestamp parses the output of time.Time.String() that version 1 used, including the monotonic
+// clock reading ("m=+0.1234") it may end with. RFC3339 is accepted too. unparseable timestamps are returned as zero.
+func parseV1Timestamp(s string) time.Time {
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999 -0700 MST", time.RFC3339Nano} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// decodeStatus reads a status document of any known version. an empty document is an empty status.
+func decodeStatus(data []byte) (Status, error) {
+	status := Status{Version: StatusVersion, Articles: []PublishedArticle{}}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return status, nil
+	}
+
+	if data[0] == '[' {
+		articles := []publishedArticleV1{}
+		err := json.Unmarshal(data, &articles)
+		if err != nil {
+			return status, err
+		}
+		status.Version = 1
+		for _, article := range articles {
+			status.Articles = append(status.Articles, article.upgrade())
+		}
+		return status, nil
+	}
+
+	err := json.Unmarshal(data, &status)
+	if err != nil {
+		return status, err
+	}
+	if status.Version > StatusVersion {
+		return status, fmt.Errorf("status was written with schema version %v, this version of mediumautopost only understands up to %v", status.Version, StatusVersion)
+	}
+	if status.Articles == nil {
+		status.Articles = []PublishedArticle{}
+	}
+	return status, nil
+}
+
+// encodeStatus writes a status document in the current version.
+func encodeStatus(status Status) ([]byte, error) {
+	status.Version = StatusVersion
+	if status.Articles == nil {
+		status.Articles = []PublishedArticle{}
+	}
+	return json.MarshalIndent(status, "", "  ")
+}
+
+// decodePublishedArticle reads a single article in either the current or the version 1 format.
+func decodePublishedArticle(data []byte) (PublishedArticle, error) {
+	article := PublishedArticle{}
+	err := json.Unmarshal(data, &article)
+	if err == nil {
+		return article, nil
+	}
+	v1 := publishedArticleV1{}
+	if json.Unmarshal(data, &v1) != nil {
+		return article, err
+	}
+	return v1.upgrade(), nil
+}
@@ -0,0 +1,221 @@
+package mediumautopost
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseV1Timestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2022-05-01 10:20:30.123456789 +0000 UTC m=+0.012345678", time.Date(2022, 5, 1, 10, 20, 30, 123456789, time.UTC)},
+		{"2022-05-01 10:20:30.5 +0000 UTC m=-1.5", time.Date(2022, 5, 1, 10, 20, 30, 500000000, time.UTC)},
+		{"2022-05-01 10:20:30 +0000 UTC", time.Date(2022, 5, 1, 10, 20, 30, 0, time.UTC)},
+		{"2022-01-15 08:00:00.25 -0500 EST m=+3600.000000001", time.Date(2022, 1, 15, 13, 0, 0, 250000000, time.UTC)},
+		{"2022-07-01 12:00:00 +0200 CEST", time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)},
+		{"2022-07-01 12:00:00 +0530 IST m=+0.1", time.Date(2022, 7, 1, 6, 30, 0, 0, time.UTC)},
+		{"2022-07-01T12:00:00+02:00", time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)},
+		{"2022-07-01T12:00:00.123Z", time.Date(2022, 7, 1, 12, 0, 0, 123000000, time.UTC)},
+		{"", time.Time{}},
+		{"yesterday", time.Time{}},
+	}
+	for _, test := range tests {
+		got := parseV1Timestamp(test.in)
+		if !got.Equal(test.want) || (!got.IsZero() && got.Location() != time.UTC) {
+			t.Errorf("parseV1Timestamp(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestDecodeStatus(t *testing.T) {
+	published := time.Date(2022, 1, 15, 13, 0, 0, 250000000, time.UTC)
+	tests := []struct {
+		name    string
+		in      string
+		version int
+		want    []PublishedArticle
+		err     string
+	}{
+		{name: "empty", in: " \n", version: StatusVersion, want: []PublishedArticle{}},
+		{name: "v1 empty", in: "[]", version: 1, want: []PublishedArticle{}},
+		{
+			name: "v1",
+			in: `[{"url":"https://example.com/one","id":"one","publishTimestamp":"2022-01-15 08:00:00.25 -0500 EST m=+3600.000000001",
+				"mediumResponse":{"id":"abc","title":"One","url":"https://medium.com/@me/one-abc","publishStatus":"draft"}}]`,
+			version: 1,
+			want: []PublishedArticle{{
+				URL: "https://example.com/one", ID: "one", PublishTimestamp: published,
+				Platforms: map[string]PlatformResult{Medium: {PostID: "abc", URL: "https://medium.com/@me/one-abc", Title: "One", PublishStatus: "draft", PublishedAt: published}},
+			}},
+		},
+		{name: "v2 without articles", in: `{"version":2}`, version: 2, want: []PublishedArticle{}},
+		{name: "unversioned object", in: `{"articles":[{"id":"one"}]}`, version: StatusVersion, want: []PublishedArticle{{ID: "one"}}},
+		{name: "future version", in: `{"version":3,"articles":[]}`, err: "schema version 3"},
+		{name: "invalid v1", in: `[{"id":1}]`, err: "cannot unmarshal"},
+		{name: "invalid", in: `"status"`, err: "cannot unmarshal"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, err := decodeStatus([]byte(test.in))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("decodeStatus() = %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Version != test.version {
+				t.Fatalf("version = %v, want %v", status.Version, test.version)
+			}
+			if len(status.Articles) != len(test.want) {
+				t.Fatalf("articles = %+v, want %+v", status.Articles, test.want)
+			}
+			for i, want := range test.want {
+				got := status.Articles[i]
+				// the v1 response is kept as it was, it is not compared
+				for platform, result := range got.Platforms {
+					result.Response = nil
+					got.Platforms[platform] = result
+				}
+				if got.ID != want.ID || got.URL != want.URL || !got.PublishTimestamp.Equal(want.PublishTimestamp) || !samePlatforms(got.Platforms, want.Platforms) {
+					t.Fatalf("article %v = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	published := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	status := Status{
+		Version: 1,
+		Articles: []PublishedArticle{{
+			URL: "https://example.com/one", ID: "one", PublishTimestamp: published, ContentHash: "hash",
+			Platforms: map[string]PlatformResult{Medium: {PostID: "abc", URL: "https://medium.com/p/abc", PublishedAt: published, Response: json.RawMessage(`{"id":"abc"}`)}},
+		}},
+		Sources:  map[string]json.RawMessage{"JSONINDEX": json.RawMessage(`{"pages":{}}`)},
+		Failures: []FailedArticle{{ID: "two", Attempts: 2}},
+	}
+	data, err := encodeStatus(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"version": 2`) {
+		t.Fatalf("encodeStatus() = %s, want version 2", data)
+	}
+	decoded, err := decodeStatus(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := encodeStatus(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) || decoded.Version != StatusVersion || !decoded.Articles[0].PublishTimestamp.Equal(published) {
+		t.Fatalf("decodeStatus(encodeStatus()) = %s, want %s", again, data)
+	}
+}
+
+func TestDecodePublishedArticle(t *testing.T) {
+	published := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	tests := map[string]string{
+		"v1": `{"url":"https://example.com/one","id":"one","publishTimestamp":"2022-07-01 12:00:00 +0200 CEST m=+0.1","mediumResponse":{"id":"abc","url":"https://medium.com/p/abc"}}`,
+		"v2": `{"url":"https://example.com/one","id":"one","publishTimestamp":"2022-07-01T10:00:00Z","platforms":{"medium":{"postId":"abc","url":"https://medium.com/p/abc","publishedAt":"2022-07-01T10:00:00Z"}}}`,
+	}
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			article, err := decodePublishedArticle([]byte(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			medium := article.Platforms[Medium]
+			if article.ID != "one" || !article.PublishTimestamp.Equal(published) || medium.PostID != "abc" || !medium.PublishedAt.Equal(published) {
+				t.Fatalf("decodePublishedArticle() = %+v", article)
+			}
+		})
+	}
+	_, err := decodePublishedArticle([]byte(`{"id":`))
+	if err == nil {
+		t.Fatal("decodePublishedArticle() of invalid json = nil, want an error")
+	}
+}
+
+func TestMigrateStatusSQLiteV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the version 1 layout, before the schema version was recorded in user_version
+	_, err = db.Exec(sqliteSchema + `
+		INSERT INTO published_articles (id, url, publish_timestamp, medium_response) VALUES
+		('one', 'https://example.com/one', '2022-01-15 08:00:00.25 -0500 EST m=+3600.000000001', '{"id":"abc","title":"One","url":"https://medium.com/p/abc"}'),
+		('two', 'https://example.com/two', '2022-07-01 12:00:00 +0200 CEST m=+0.1', '{"id":"def","title":"Two","url":"https://medium.com/p/def"}');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	t.Setenv("STORAGE_TYPE", string(SQLite))
+	t.Setenv("SQLITE_PATH", path)
+	err = MigrateStatus("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := newSQLiteStore(Config{SQLitePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.(*sqliteStore).Close()
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != StatusVersion || len(status.Articles) != 2 {
+		t.Fatalf("Load() after MigrateStatus() = %+v, want the articles at version %v", status, StatusVersion)
+	}
+	want := map[string]time.Time{"one": time.Date(2022, 1, 15, 13, 0, 0, 250000000, time.UTC), "two": time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)}
+	for _, article := range status.Articles {
+		if !article.PublishTimestamp.Equal(want[article.ID]) || article.Platforms[Medium].Title == "" {
+			t.Fatalf("migrated article = %+v, want it published at %v", article, want[article.ID])
+		}
+	}
+	empty, version := 0, 0
+	err = store.(*sqliteStore).db.QueryRow(`SELECT COUNT(*) FROM published_articles WHERE platforms = ''`).Scan(&empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.(*sqliteStore).db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty != 0 || version != len(sqliteMigrations)+1 {
+		t.Fatalf("%v rows left in the version 1 layout at schema version %v", empty, version)
+	}
+}
+
+// samePlatforms compares the results of two articles, with the times compared as instants.
+func samePlatforms(a, b map[string]PlatformResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for platform, result := range a {
+		other, ok := b[platform]
+		if !ok || !result.PublishedAt.Equal(other.PublishedAt) {
+			return false
+		}
+		if result.PostID != other.PostID || result.URL != other.URL || result.Title != other.Title || result.PublishStatus != other.PublishStatus {
+			return false
+		}
+	}
+	return true
+}
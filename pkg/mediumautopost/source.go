@@ -0,0 +1,92 @@
+package mediumautopost
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ArticleSource is where the articles to post to medium.com come from.
+// Index lists every article the source knows about, and Article returns the full content of one of them.
+// Index is always called before Article.
+type ArticleSource interface {
+	Index() ([]ArticleIndexItem, error)
+	Article(item ArticleIndexItem) (ArticleJSONData, error)
+}
+
+// StatefulSource is an ArticleSource that keeps state between runs, e.g. to only fetch what changed since
+// the last run. RestoreState is called with the state saved by the last successful run before Index is called,
+// State is called at the end of the run and the result is saved in the status store. State is only saved when
+// every article was posted, so a source can assume the articles it listed before the state was saved are done.
+type StatefulSource interface {
+	ArticleSource
+	RestoreState(state json.RawMessage) error
+	State() (json.RawMessage, error)
+}
+
+// SourceType is the name an article source is registered under. It is set with SOURCE_TYPE.
+type SourceType string
+
+// JSONIndex is the original source: a json index of {url,id} items, each pointing at a json payload
+// with the article, as generated by the hugo templates described in the README.
+const JSONIndex SourceType = "JSON_INDEX"
+
+// ArticleSourceFactory builds an ArticleSource from the config. It is called once per run.
+type ArticleSourceFactory func(c Config, client http.Client) (ArticleSource, error)
+
+var (
+	articleSourcesMu sync.RWMutex
+	articleSources   = map[SourceType]ArticleSourceFactory{}
+)
+
+// RegisterArticleSource makes an article source available under the given source type.
+// Library users can call this from an init function to add their own source, then select it
+// by setting SOURCE_TYPE to the same name. Registering a name twice replaces the previous factory.
+func RegisterArticleSource(sourceType SourceType, factory ArticleSourceFactory) {
+	articleSourcesMu.Lock()
+	defer articleSourcesMu.Unlock()
+	articleSources[SourceType(strings.ToUpper(string(sourceType)))] = factory
+}
+
+// SourceTypes returns the names of all registered article sources, sorted.
+func SourceTypes() []SourceType {
+	articleSourcesMu.RLock()
+	defer articleSourcesMu.RUnlock()
+	types := []SourceType{}
+	for t := range articleSources {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// NewArticleSource builds the article source registered for the given source type.
+func NewArticleSource(sourceType SourceType, c Config, client http.Client) (ArticleSource, error) {
+	articleSourcesMu.RLock()
+	factory, ok := articleSources[SourceType(strings.ToUpper(string(sourceType)))]
+	articleSourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source type %q, available types are %v", sourceType, SourceTypes())
+	}
+	return factory(c, client)
+}
+
+// newArticleSource picks the article source for this run based on the config. an empty SOURCE_TYPE means JSON_INDEX.
+func newArticleSource(c Config, client http.Client) (ArticleSource, error) {
+	return NewArticleSource(sourceTypeOf(c), c, client)
+}
+
+// sourceTypeOf returns the source type for the config, the state of a StatefulSource is saved under this name.
+func sourceTypeOf(c Config) SourceType {
+	if c.SourceType == "" {
+		return JSONIndex
+	}
+	return SourceType(strings.ToUpper(string(c.SourceType)))
+}
+
+func init() {
+	RegisterArticleSource(JSONIndex, newJSONIndexSource)
+}
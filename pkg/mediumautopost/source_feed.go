@@ -0,0 +1,199 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Feed is the source type for reading articles from a standard RSS 2.0 or Atom feed at FEED_URL.
+const Feed SourceType = "FEED"
+
+// feedSource reads an RSS 2.0 or Atom feed. the feed already contains the full articles
+// so they are kept from Index and Article does not fetch anything.
+type feedSource struct {
+	client   http.Client
+	feedURL  string
+	articles map[string]ArticleJSONData
+}
+
+// rssFeed is the part of an RSS 2.0 document we need.
+type rssFeed struct {
+	Items []struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		GUID        string   `xml:"guid"`
+		PubDate     string   `xml:"pubDate"`
+		Description string   `xml:"description"`
+		Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		Categories  []string `xml:"category"`
+	} `xml:"channel>item"`
+}
+
+// atomFeed is the part of an Atom document we need.
+type atomFeed struct {
+	Entries []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Links     []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Content    atomText `xml:"content"`
+		Summary    atomText `xml:"summary"`
+		Categories []struct {
+			Term string `xml:"term,attr"`
+		} `xml:"category"`
+	} `xml:"entry"`
+}
+
+// atomText is an Atom <content> or <summary>. its type says how the content is written: "html" is escaped
+// html in the text, "xhtml" is markup inside a single <div> and "text" (the default) is plain text.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// html returns the content as html.
+func (t atomText) html() string {
+	switch strings.ToLower(strings.TrimSpace(t.Type)) {
+	case "html", "text/html":
+		return t.Text
+	case "xhtml", "application/xhtml+xml":
+		inner := strings.TrimSpace(t.Inner)
+		// drop the wrapping <div xmlns="http://www.w3.org/1999/xhtml">
+		start := strings.Index(inner, ">")
+		end := strings.LastIndex(inner, "</")
+		if strings.HasPrefix(inner, "<") && start >= 0 && end > start {
+			inner = inner[start+1 : end]
+		}
+		return strings.TrimSpace(inner)
+	default:
+		return html.EscapeString(strings.TrimSpace(t.Text))
+	}
+}
+
+func newFeedSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.FeedURL == "" {
+		return nil, errors.New("SOURCE_TYPE is FEED but FEED_URL is empty")
+	}
+	return &feedSource{client: client, feedURL: c.FeedURL, articles: map[string]ArticleJSONData{}}, nil
+}
+
+// Index fetches the feed and turns every item into an article. the guid (RSS) or id (Atom) is the article ID,
+// falling back to the link when it is missing.
+func (s *feedSource) Index() ([]ArticleIndexItem, error) {
+	data, err := fetchURL(s.client, s.feedURL)
+	if err != nil {
+		return []ArticleIndexItem{}, err
+	}
+	root, err := xmlRootName(data)
+	if err != nil {
+		return []ArticleIndexItem{}, err
+	}
+
+	index := []ArticleIndexItem{}
+	add := func(id string, date string, article ArticleJSONData) {
+		if id == "" {
+			id = article.CanonicalURL
+		}
+		s.articles[id] = article
+		index = append(index, ArticleIndexItem{URL: article.CanonicalURL, ID: id, Date: strings.TrimSpace(date), Tags: article.Tags})
+	}
+
+	switch root {
+	case "rss":
+		feed := rssFeed{}
+		err = xml.Unmarshal(data, &feed)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		for _, item := range feed.Items {
+			content := item.Content
+			if content == "" {
+				content = item.Description
+			}
+			add(strings.TrimSpace(item.GUID), item.PubDate, ArticleJSONData{
+				Title:         strings.TrimSpace(item.Title),
+				ContentFormat: "html",
+				Content:       content,
+				CanonicalURL:  strings.TrimSpace(item.Link),
+				Tags:          item.Categories,
+			})
+		}
+	case "feed":
+		feed := atomFeed{}
+		err = xml.Unmarshal(data, &feed)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		for _, entry := range feed.Entries {
+			link := ""
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			content := entry.Content.html()
+			if content == "" {
+				content = entry.Summary.html()
+			}
+			tags := []string{}
+			for _, category := range entry.Categories {
+				tags = append(tags, category.Term)
+			}
+			published := entry.Published
+			if published == "" {
+				published = entry.Updated
+			}
+			add(strings.TrimSpace(entry.ID), published, ArticleJSONData{
+				Title:         strings.TrimSpace(entry.Title),
+				ContentFormat: "html",
+				Content:       content,
+				CanonicalURL:  strings.TrimSpace(link),
+				Tags:          tags,
+			})
+		}
+	default:
+		return []ArticleIndexItem{}, fmt.Errorf("%s is not an RSS or Atom feed, the root element is <%s>", s.feedURL, root)
+	}
+
+	log.Printf("found feed containing a total of %v articles", len(index))
+	return index, nil
+}
+
+// Article returns the article read from the feed by Index.
+func (s *feedSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	article, ok := s.articles[item.ID]
+	if !ok {
+		return article, fmt.Errorf("article %s is not in the feed", item.ID)
+	}
+	return article, nil
+}
+
+// xmlRootName returns the local name of the root element of an xml document.
+func xmlRootName(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func init() {
+	RegisterArticleSource(Feed, newFeedSource)
+}
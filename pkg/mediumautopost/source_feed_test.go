@@ -0,0 +1,63 @@
+package mediumautopost
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeedSourceAtomContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry>
+    <id>html</id><title>Html</title><link href="https://example.com/html/"/>
+    <summary>the summary</summary>
+    <content type="html">&lt;p&gt;Hello &amp;amp; welcome&lt;/p&gt;</content>
+  </entry>
+  <entry>
+    <id>xhtml</id><title>Xhtml</title><link href="https://example.com/xhtml/"/>
+    <summary>the summary</summary>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Hello <b>world</b></p></div></content>
+  </entry>
+  <entry>
+    <id>text</id><title>Text</title><link href="https://example.com/text/"/>
+    <content>1 &lt; 2</content>
+  </entry>
+  <entry>
+    <id>summary</id><title>Summary</title><link href="https://example.com/summary/"/>
+    <summary type="html">&lt;p&gt;only a summary&lt;/p&gt;</summary>
+  </entry>
+</feed>`)
+	}))
+	defer server.Close()
+
+	source, err := newFeedSource(Config{FeedURL: server.URL}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := source.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"html":    `<p>Hello &amp; welcome</p>`,
+		"xhtml":   `<p>Hello <b>world</b></p>`,
+		"text":    `1 &lt; 2`,
+		"summary": `<p>only a summary</p>`,
+	}
+	if len(index) != len(want) {
+		t.Fatalf("Index() returned %v articles, want %v", len(index), len(want))
+	}
+	for _, item := range index {
+		article, err := source.Article(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if article.Content != want[item.ID] {
+			t.Errorf("content of %s = %q, want %q", item.ID, article.Content, want[item.ID])
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package mediumautopost
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Ghost is the source type for reading articles from the Content API of a Ghost blog at GHOST_URL.
+const Ghost SourceType = "GHOST"
+
+// ghostPageSize is the number of posts fetched per request.
+const ghostPageSize = 100
+
+// ghostSource pages through /ghost/api/content/posts with a Content API key. the posts come with their html
+// and tags, so they are kept from Index and Article does not fetch anything.
+type ghostSource struct {
+	client   http.Client
+	siteURL  string
+	key      string
+	articles map[string]ArticleJSONData
+}
+
+// ghostPost is the part of a post from the Content API we need.
+type ghostPost struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	HTML         string `json:"html"`
+	URL          string `json:"url"`
+	CanonicalURL string `json:"canonical_url"`
+	FeatureImage string `json:"feature_image"`
+	PublishedAt  string `json:"published_at"`
+	Tags         []struct {
+		Name       string `json:"name"`
+		Visibility string `json:"visibility"`
+	} `json:"tags"`
+}
+
+// ghostPostsPage is one page of posts. next is the number of the next page, null on the last one.
+type ghostPostsPage struct {
+	Posts []ghostPost `json:"posts"`
+	Meta  struct {
+		Pagination struct {
+			Next *int `json:"next"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+func newGhostSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.GhostURL == "" || c.GhostContentAPIKey == "" {
+		return nil, errors.New("SOURCE_TYPE is GHOST but GHOST_URL or GHOST_CONTENT_API_KEY is empty")
+	}
+	return &ghostSource{
+		client:   client,
+		siteURL:  strings.TrimRight(c.GhostURL, "/"),
+		key:      c.GhostContentAPIKey,
+		articles: map[string]ArticleJSONData{},
+	}, nil
+}
+
+// Index fetches every post, following meta.pagination.next. the Ghost post id is the article ID.
+func (s *ghostSource) Index() ([]ArticleIndexItem, error) {
+	index := []ArticleIndexItem{}
+	for page := 1; page > 0; {
+		query := url.Values{}
+		query.Set("key", s.key)
+		query.Set("include", "tags")
+		query.Set("formats", "html")
+		query.Set("limit", fmt.Sprint(ghostPageSize))
+		query.Set("page", fmt.Sprint(page))
+		result := ghostPostsPage{}
+		err := doJSON(s.client, http.MethodGet, s.siteURL+"/ghost/api/content/posts/?"+query.Encode(), nil, nil, &result)
+		if err != nil {
+			return []ArticleIndexItem{}, redactKey(err, s.key)
+		}
+		for _, post := range result.Posts {
+			article := post.article()
+			s.articles[post.ID] = article
+			index = append(index, ArticleIndexItem{URL: article.CanonicalURL, ID: post.ID, Date: post.PublishedAt, Tags: article.Tags})
+		}
+		page = 0
+		if next := result.Meta.Pagination.Next; next != nil {
+			page = *next
+		}
+	}
+
+	log.Printf("found ghost blog containing a total of %v articles", len(index))
+	return index, nil
+}
+
+// Article returns the article read from the Content API by Index.
+func (s *ghostSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	article, ok := s.articles[item.ID]
+	if !ok {
+		return article, fmt.Errorf("article %s is not on %s", item.ID, s.siteURL)
+	}
+	return article, nil
+}
+
+// article turns a post into the payload for medium.com. the canonical url set in Ghost wins over the post's url,
+// internal tags (the ones starting with #) are left out and the feature image is put at the top of the content.
+func (p ghostPost) article() ArticleJSONData {
+	content := p.HTML
+	if p.FeatureImage != "" {
+		content = fmt.Sprintf("<figure><img src=\"%s\"></figure>\n%s", html.EscapeString(p.FeatureImage), content)
+	}
+	tags := []string{}
+	for _, tag := range p.Tags {
+		if tag.Visibility == "internal" || strings.HasPrefix(tag.Name, "#") {
+			continue
+		}
+		tags = append(tags, tag.Name)
+	}
+	canonicalURL := p.CanonicalURL
+	if canonicalURL == "" {
+		canonicalURL = p.URL
+	}
+	return ArticleJSONData{
+		Title:         strings.TrimSpace(p.Title),
+		ContentFormat: "html",
+		Content:       content,
+		CanonicalURL:  canonicalURL,
+		Tags:          tags,
+	}
+}
+
+// redactKey keeps the content api key out of an error, and so out of the logs. the url of the request, with the key
+// in its query, is in an *apiError when Ghost answered with an error and in a *url.Error when the request failed.
+func redactKey(err error, key string) error {
+	redact := func(s string) string {
+		s = strings.Replace(s, url.QueryEscape(key), "REDACTED", -1)
+		return strings.Replace(s, key, "REDACTED", -1)
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		apiErr.URL = redact(apiErr.URL)
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redact(urlErr.URL)
+	}
+	// anything else that still has it is replaced by a plain error
+	if message := err.Error(); strings.Contains(message, key) {
+		return errors.New(redact(message))
+	}
+	return err
+}
+
+func init() {
+	RegisterArticleSource(Ghost, newGhostSource)
+}
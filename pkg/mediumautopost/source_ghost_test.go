@@ -0,0 +1,120 @@
+package mediumautopost
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testGhost is a stand-in for the Content API of a Ghost blog with two pages of posts.
+func testGhost(t *testing.T, key string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/ghost/api/content/posts/" || query.Get("include") != "tags" {
+			http.NotFound(w, r)
+			return
+		}
+		if query.Get("key") != key {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"errors":[{"message":"Unknown Content API Key"}]}`)
+			return
+		}
+		switch query.Get("page") {
+		case "1":
+			fmt.Fprint(w, `{"posts":[{"id":"p1","title":" First ","html":"<p>one</p>","url":"https://blog.example.com/first/",
+				"canonical_url":"https://example.com/first/","feature_image":"https://blog.example.com/first.png",
+				"published_at":"2022-05-01T10:00:00.000Z","tags":[{"name":"go","visibility":"public"},
+				{"name":"#hidden","visibility":"internal"},{"name":"#legacy"}]}],
+				"meta":{"pagination":{"page":1,"pages":2,"next":2}}}`)
+		case "2":
+			fmt.Fprint(w, `{"posts":[{"id":"p2","title":"Second","html":"<p>two</p>","url":"https://blog.example.com/second/",
+				"canonical_url":null,"tags":[]}],"meta":{"pagination":{"page":2,"pages":2,"next":null}}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGhostSource(t *testing.T) {
+	server := testGhost(t, "secretkey")
+	source, err := newGhostSource(Config{GhostURL: server.URL + "/", GhostContentAPIKey: "secretkey"}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := source.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 2 || index[0].ID != "p1" || index[1].ID != "p2" {
+		t.Fatalf("Index() = %+v, want the posts of both pages", index)
+	}
+	if index[0].Date != "2022-05-01T10:00:00.000Z" {
+		t.Fatalf("date = %q, want published_at", index[0].Date)
+	}
+
+	first, err := source.Article(index[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Title != "First" || first.ContentFormat != "html" {
+		t.Fatalf("article = %+v", first)
+	}
+	if first.CanonicalURL != "https://example.com/first/" {
+		t.Fatalf("canonical url = %q, want canonical_url over url", first.CanonicalURL)
+	}
+	if len(first.Tags) != 1 || first.Tags[0] != "go" {
+		t.Fatalf("tags = %v, want only the public tag", first.Tags)
+	}
+	if !strings.HasPrefix(first.Content, `<figure><img src="https://blog.example.com/first.png"></figure>`) {
+		t.Fatalf("content = %q, want the feature image first", first.Content)
+	}
+
+	second, err := source.Article(index[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.CanonicalURL != "https://blog.example.com/second/" {
+		t.Fatalf("canonical url = %q, want url without a canonical_url", second.CanonicalURL)
+	}
+
+	if _, err := source.Article(ArticleIndexItem{ID: "p3"}); err == nil {
+		t.Fatal("Article() of an unknown post succeeded")
+	}
+}
+
+func TestGhostSourceRedactsKey(t *testing.T) {
+	server := testGhost(t, "secretkey")
+	source, err := newGhostSource(Config{GhostURL: server.URL, GhostContentAPIKey: "wrongkey"}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = source.Index()
+	if !isStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("Index() = %v, want a 401 apiError", err)
+	}
+	if strings.Contains(err.Error(), "wrongkey") || !strings.Contains(err.Error(), "REDACTED") {
+		t.Fatalf("error %q does not redact the content api key", err)
+	}
+
+	// a request that fails has the url, with the key, in its *url.Error
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	source, err = newGhostSource(Config{GhostURL: closed.URL, GhostContentAPIKey: "secretkey"}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = source.Index()
+	if err == nil {
+		t.Fatal("Index() of a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "secretkey") || !strings.Contains(err.Error(), "REDACTED") {
+		t.Fatalf("error %q does not redact the content api key", err)
+	}
+}
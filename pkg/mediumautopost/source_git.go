@@ -0,0 +1,185 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Git is the source type for reading the markdown posts in CONTENT_DIR of a local git checkout, only looking at the
+// files that changed since the commit processed by the last run.
+const Git SourceType = "GIT"
+
+// gitSource is a markdown source that uses git to find the posts added or changed since the last run. the last
+// processed commit is kept as the source state. posts dated in the future are remembered as pending and looked at
+// again on every run until they are published.
+type gitSource struct {
+	*markdownSource
+	lastCommit string
+	pending    []string
+	// head and stillPending are the state of this run
+	head         string
+	stillPending []string
+}
+
+// gitState is the state of the git source saved in the status store. pending paths are relative to CONTENT_DIR.
+type gitState struct {
+	Commit  string   `json:"commit"`
+	Pending []string `json:"pending,omitempty"`
+}
+
+func newGitSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.ContentDir == "" {
+		return nil, errors.New("SOURCE_TYPE is GIT but CONTENT_DIR is empty")
+	}
+	markdown, err := newMarkdownSource(c, client)
+	if err != nil {
+		return nil, err
+	}
+	source := &gitSource{markdownSource: markdown.(*markdownSource)}
+	// git reports absolute paths from the top of the repo with the symlinks resolved, so the content dir must be
+	// absolute and resolved too. the section keeps the configured name so the IDs don't depend on where it points.
+	contentDir, err := filepath.Abs(c.ContentDir)
+	if err != nil {
+		return nil, err
+	}
+	source.section = filepath.Base(contentDir)
+	source.contentDir, err = filepath.EvalSymlinks(contentDir)
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Index lists the posts added or changed in CONTENT_DIR between the last processed commit and HEAD, plus
+// the pending ones. changed posts are included so a draft is posted once it is published, posts that were already
+// posted are filtered out by their ID as usual. without a last commit (the first run, or after history was
+// rewritten) every post in HEAD is listed. git prints the paths relative to the top of the repo.
+func (s *gitSource) Index() ([]ArticleIndexItem, error) {
+	head, err := runGit(s.contentDir, "rev-parse", "HEAD")
+	if err != nil {
+		return []ArticleIndexItem{}, err
+	}
+	s.head = head
+
+	files := []string{}
+	if s.lastCommit != "" {
+		_, err = runGit(s.contentDir, "cat-file", "-e", s.lastCommit+"^{commit}")
+		if err != nil {
+			log.Printf("last processed commit %s is not in the repo anymore, looking at every post", s.lastCommit)
+			s.lastCommit = ""
+		}
+	}
+	if s.lastCommit == "" {
+		files, err = runGitList(s.contentDir, "ls-tree", "-r", "-z", "--name-only", "--full-name", "HEAD", "--", ".")
+	} else {
+		files, err = runGitList(s.contentDir, "diff", "-z", "--name-only", "--diff-filter=AM", "--no-renames", s.lastCommit, "HEAD", "--", ".")
+		if err == nil {
+			log.Printf("%v files changed since commit %s", len(files), s.lastCommit)
+		}
+	}
+	if err != nil {
+		return []ArticleIndexItem{}, err
+	}
+
+	top, err := runGit(s.contentDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return []ArticleIndexItem{}, err
+	}
+	paths := map[string]bool{}
+	for _, file := range files {
+		paths[filepath.Join(top, filepath.FromSlash(file))] = true
+	}
+	for _, file := range s.pending {
+		paths[filepath.Join(s.contentDir, filepath.FromSlash(file))] = true
+	}
+
+	index := []ArticleIndexItem{}
+	now := time.Now()
+	for file := range paths {
+		if !isMarkdownPost(file) {
+			continue
+		}
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		post, item, err := s.readPost(file)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		if post.Date.After(now) && !post.Draft {
+			rel, err := filepath.Rel(s.contentDir, file)
+			if err != nil {
+				return []ArticleIndexItem{}, err
+			}
+			s.stillPending = append(s.stillPending, filepath.ToSlash(rel))
+		}
+		if !isPublished(file, post, now) {
+			continue
+		}
+		index = append(index, item)
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i].ID < index[j].ID })
+	sort.Strings(s.stillPending)
+
+	log.Printf("found %v new or changed articles in git", len(index))
+	return index, nil
+}
+
+// RestoreState reads the commit processed by the last successful run.
+func (s *gitSource) RestoreState(state json.RawMessage) error {
+	saved := gitState{}
+	err := json.Unmarshal(state, &saved)
+	if err != nil {
+		return err
+	}
+	s.lastCommit = saved.Commit
+	s.pending = saved.Pending
+	return nil
+}
+
+// State returns HEAD as the last processed commit.
+func (s *gitSource) State() (json.RawMessage, error) {
+	return json.Marshal(gitState{Commit: s.head, Pending: s.stillPending})
+}
+
+// runGit runs a git command in dir and returns its trimmed output.
+func runGit(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// runGitList runs a git command that prints a NUL separated (-z) list of paths.
+func runGitList(dir string, args ...string) ([]string, error) {
+	output, err := runGit(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, item := range strings.Split(output, "\x00") {
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
+
+func init() {
+	RegisterArticleSource(Git, newGitSource)
+}
@@ -0,0 +1,51 @@
+package mediumautopost
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitSourceSymlinkedContentDir(t *testing.T) {
+	repo := t.TempDir()
+	posts := filepath.Join(repo, "content", "blog")
+	err := os.MkdirAll(posts, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(posts, "hello.md"), []byte("---\ntitle: Hello\ndate: 2020-01-02T03:04:05Z\n---\nhello world\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "first post"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	// CONTENT_DIR points at the posts through a symlink, which git resolves
+	link := filepath.Join(t.TempDir(), "posts")
+	err = os.Symlink(posts, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := newGitSource(Config{ContentDir: link}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := source.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 || index[0].ID != "posts/hello" {
+		t.Fatalf("Index() = %+v, want posts/hello", index)
+	}
+}
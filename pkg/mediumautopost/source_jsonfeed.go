@@ -0,0 +1,127 @@
+package mediumautopost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// JSONFeed is the source type for reading articles from a JSON Feed (https://jsonfeed.org) at FEED_URL.
+const JSONFeed SourceType = "JSON_FEED"
+
+// jsonFeedSource reads a JSON Feed, following next_url to the following pages. like the RSS and Atom feeds
+// the items contain the full articles, so they are kept from Index and Article does not fetch anything.
+type jsonFeedSource struct {
+	client   http.Client
+	feedURL  string
+	articles map[string]ArticleJSONData
+}
+
+// jsonFeed is the part of a JSON Feed document we need.
+type jsonFeed struct {
+	Version string `json:"version"`
+	NextURL string `json:"next_url"`
+	Items   []struct {
+		ID            string   `json:"id"`
+		URL           string   `json:"url"`
+		Title         string   `json:"title"`
+		ContentHTML   string   `json:"content_html"`
+		ContentText   string   `json:"content_text"`
+		Tags          []string `json:"tags"`
+		DatePublished string   `json:"date_published"`
+		Language      string   `json:"language"`
+	} `json:"items"`
+}
+
+func newJSONFeedSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.FeedURL == "" {
+		return nil, errors.New("SOURCE_TYPE is JSON_FEED but FEED_URL is empty")
+	}
+	return &jsonFeedSource{client: client, feedURL: c.FeedURL, articles: map[string]ArticleJSONData{}}, nil
+}
+
+// Index fetches every page of the feed and turns every item into an article. content_html is posted as html,
+// content_text (when there is no html) is plain text and is escaped, see textToHTML. items without an id use
+// their url as the ID.
+func (s *jsonFeedSource) Index() ([]ArticleIndexItem, error) {
+	index := []ArticleIndexItem{}
+	seen := map[string]bool{}
+	for pageURL := s.feedURL; pageURL != ""; {
+		if seen[pageURL] {
+			return []ArticleIndexItem{}, fmt.Errorf("json feed next_url loops back to %s", pageURL)
+		}
+		seen[pageURL] = true
+
+		data, err := fetchURL(s.client, pageURL)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		feed := jsonFeed{}
+		err = json.Unmarshal(data, &feed)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		if !strings.HasPrefix(feed.Version, "https://jsonfeed.org/version/") {
+			return []ArticleIndexItem{}, fmt.Errorf("%s is not a json feed, the version is %q", pageURL, feed.Version)
+		}
+
+		for _, item := range feed.Items {
+			article := ArticleJSONData{
+				Title:         strings.TrimSpace(item.Title),
+				ContentFormat: "html",
+				Content:       item.ContentHTML,
+				CanonicalURL:  strings.TrimSpace(item.URL),
+				Tags:          item.Tags,
+			}
+			if article.Content == "" {
+				article.Content = textToHTML(item.ContentText)
+			}
+			id := strings.TrimSpace(item.ID)
+			if id == "" {
+				id = article.CanonicalURL
+			}
+			s.articles[id] = article
+			index = append(index, ArticleIndexItem{URL: article.CanonicalURL, ID: id, Date: item.DatePublished, Tags: item.Tags, Lang: item.Language})
+		}
+		err = checkLinkedURL(pageURL, feed.NextURL)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		pageURL = feed.NextURL
+	}
+
+	log.Printf("found json feed containing a total of %v articles", len(index))
+	return index, nil
+}
+
+// textToHTML turns plain text into html paragraphs. blank lines separate the paragraphs and the other line
+// breaks are kept, everything else is escaped so the text is not read as markup.
+func textToHTML(text string) string {
+	paragraphs := []string{}
+	for _, paragraph := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		lines := strings.Split(html.EscapeString(paragraph), "\n")
+		paragraphs = append(paragraphs, "<p>"+strings.Join(lines, "<br>")+"</p>")
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+// Article returns the article read from the feed by Index.
+func (s *jsonFeedSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	article, ok := s.articles[item.ID]
+	if !ok {
+		return article, fmt.Errorf("article %s is not in the json feed", item.ID)
+	}
+	return article, nil
+}
+
+func init() {
+	RegisterArticleSource(JSONFeed, newJSONFeedSource)
+}
@@ -0,0 +1,117 @@
+package mediumautopost
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testJSONFeed serves the pages of a json feed by path. {{server}} in a page is replaced with the server's url.
+func testJSONFeed(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, strings.Replace(page, "{{server}}", server.URL, -1))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestJSONFeedSourceFollowsNextURL(t *testing.T) {
+	server := testJSONFeed(t, map[string]string{
+		"/feed.json": `{"version":"https://jsonfeed.org/version/1.1","next_url":"{{server}}/feed/2.json","items":[
+			{"id":"one","url":"https://example.com/one/","title":" One ","content_html":"<p>one</p>","tags":["go"],"date_published":"2022-05-01T10:00:00Z","language":"en"}]}`,
+		"/feed/2.json": `{"version":"https://jsonfeed.org/version/1","next_url":"{{server}}/feed/3.json","items":[
+			{"url":"https://example.com/two/","title":"Two","content_html":"<p>two</p>"}]}`,
+		"/feed/3.json": `{"version":"https://jsonfeed.org/version/1.1","items":[]}`,
+	})
+	source, err := newJSONFeedSource(Config{FeedURL: server.URL + "/feed.json"}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := source.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the item without an id uses its url
+	if got := indexIDs(index); got != "one,https://example.com/two/" {
+		t.Fatalf("Index() = %s, want the items of every page", got)
+	}
+	if item := index[0]; item.URL != "https://example.com/one/" || item.Date != "2022-05-01T10:00:00Z" || item.Lang != "en" || strings.Join(item.Tags, ",") != "go" {
+		t.Fatalf("index item = %+v", item)
+	}
+	article, err := source.Article(index[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "One" || article.ContentFormat != "html" || article.Content != "<p>one</p>" || article.CanonicalURL != "https://example.com/one/" {
+		t.Fatalf("Article() = %+v", article)
+	}
+}
+
+func TestJSONFeedSourceErrors(t *testing.T) {
+	tests := map[string]struct {
+		pages map[string]string
+		err   string
+	}{
+		"no version":      {map[string]string{"/feed.json": `{"items":[]}`}, "not a json feed"},
+		"other version":   {map[string]string{"/feed.json": `{"version":"1.0","items":[]}`}, "not a json feed"},
+		"rss":             {map[string]string{"/feed.json": `<rss version="2.0"></rss>`}, "invalid character"},
+		"version on page": {map[string]string{"/feed.json": `{"version":"https://jsonfeed.org/version/1","next_url":"{{server}}/2.json","items":[]}`, "/2.json": `{"items":[]}`}, "not a json feed"},
+		"loop": {map[string]string{
+			"/feed.json": `{"version":"https://jsonfeed.org/version/1","next_url":"{{server}}/2.json","items":[]}`,
+			"/2.json":    `{"version":"https://jsonfeed.org/version/1","next_url":"{{server}}/feed.json","items":[]}`,
+		}, "loops back"},
+		"missing page":   {map[string]string{"/feed.json": `{"version":"https://jsonfeed.org/version/1","next_url":"{{server}}/2.json","items":[]}`}, "404"},
+		"next_url local": {map[string]string{"/feed.json": `{"version":"https://jsonfeed.org/version/1","next_url":"file:///etc/passwd","items":[]}`}, "file"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := testJSONFeed(t, test.pages)
+			source, err := newJSONFeedSource(Config{FeedURL: server.URL + "/feed.json"}, http.Client{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := source.Index()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Index() = %+v, %v, want an error containing %q", index, err, test.err)
+			}
+		})
+	}
+}
+
+func TestJSONFeedSourceContentText(t *testing.T) {
+	server := testJSONFeed(t, map[string]string{
+		"/feed.json": `{"version":"https://jsonfeed.org/version/1.1","items":[
+			{"id":"text","title":"Text","content_text":"1 < 2 & <b>not bold</b>\r\nsame paragraph\n\n\n# not a heading *or emphasis*\n"},
+			{"id":"both","title":"Both","content_html":"<p>html</p>","content_text":"text"}]}`,
+	})
+	source, err := newJSONFeedSource(Config{FeedURL: server.URL + "/feed.json"}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := source.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"text": "<p>1 &lt; 2 &amp; &lt;b&gt;not bold&lt;/b&gt;<br>same paragraph</p>\n<p># not a heading *or emphasis*</p>",
+		"both": "<p>html</p>",
+	}
+	for _, item := range index {
+		article, err := source.Article(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if article.ContentFormat != "html" || article.Content != want[item.ID] {
+			t.Errorf("article %s is %s %q, want html %q", item.ID, article.ContentFormat, article.Content, want[item.ID])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package mediumautopost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// jsonIndexSource reads the json index at WEBSITE_JSON_INDEX_URL, then fetches each article's json payload
+// from the url in its index item.
+//
+// the index is either one json array of {url,id} items, or split in pages. a page is either an array, with the
+// next page in a Link: <url>; rel="next" header, or an object {"items":[...],"next":"url"}. the validators
+// (ETag and Last-Modified) of every page are kept as the source state, so pages that did not change since the
+// last run are answered with 304 Not Modified and are not downloaded or compared again.
+//
+// WEBSITE_JSON_INDEX_URL can also be a local path or a file:// url, e.g. the index of a site that was just built.
+// the article urls in the index are resolved relative to the page of the index they are on. they can only be
+// file:// urls when the index is read from disk too.
+type jsonIndexSource struct {
+	client   http.Client
+	indexURL string
+	// pages is the state restored from the last run, seen is the state of this run
+	pages map[string]jsonIndexPage
+	seen  map[string]jsonIndexPage
+}
+
+// jsonIndexPage is what is remembered about a page of the index between runs.
+type jsonIndexPage struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Next         string `json:"next,omitempty"`
+}
+
+// jsonIndexState is the state of the json index source saved in the status store.
+type jsonIndexState struct {
+	Pages map[string]jsonIndexPage `json:"pages"`
+}
+
+func newJSONIndexSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.WebsiteJSONIndexURL == "" {
+		return nil, errors.New("WEBSITE_JSON_INDEX_URL is empty")
+	}
+	indexURL, err := fileURL(c.WebsiteJSONIndexURL)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonIndexSource{
+		client:   client,
+		indexURL: indexURL,
+		pages:    map[string]jsonIndexPage{},
+		seen:     map[string]jsonIndexPage{},
+	}, nil
+}
+
+// Index pulls the index from the origin website, page by page.
+// as can be seen here: https://askcloudarchitech.com/posts/index.json
+// pages that did not change since the last successful run are skipped, their articles have been posted already.
+func (s *jsonIndexSource) Index() ([]ArticleIndexItem, error) {
+	indexOfArticlesOnWebsite := []ArticleIndexItem{}
+	unchanged := 0
+	for pageURL := s.indexURL; pageURL != ""; {
+		if _, ok := s.seen[pageURL]; ok {
+			return []ArticleIndexItem{}, fmt.Errorf("json index pages loop back to %s", pageURL)
+		}
+		items, page, modified, err := s.fetchPage(pageURL)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		s.seen[pageURL] = page
+		if !modified {
+			unchanged++
+		}
+		indexOfArticlesOnWebsite = append(indexOfArticlesOnWebsite, items...)
+		pageURL = page.Next
+	}
+	if unchanged > 0 {
+		log.Printf("%v of %v index pages did not change since the last run", unchanged, len(s.seen))
+	}
+	log.Printf("found index containing a total of %v new or changed articles", len(indexOfArticlesOnWebsite))
+	return indexOfArticlesOnWebsite, nil
+}
+
+// fetchPage gets one page of the index, conditionally if it was seen in the last run. modified is false
+// when the server answered 304, the page is then what was remembered and there are no items.
+func (s *jsonIndexSource) fetchPage(pageURL string) ([]ArticleIndexItem, jsonIndexPage, bool, error) {
+	cached, known := s.pages[pageURL]
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, cached, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if known && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if known && cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, cached, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && known {
+		return nil, cached, false, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, cached, false, &apiError{Method: http.MethodGet, URL: pageURL, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	items, next, err := decodeJSONIndexPage(resp.Body)
+	if err != nil {
+		return nil, cached, false, fmt.Errorf("%s: %v", pageURL, err)
+	}
+	for i := range items {
+		items[i].URL = resolveURL(pageURL, items[i].URL)
+		err = checkLinkedURL(pageURL, items[i].URL)
+		if err != nil {
+			return nil, cached, false, err
+		}
+	}
+	if next == "" {
+		next = linkHeaderNext(resp.Header)
+	}
+	if next != "" {
+		next = resolveURL(pageURL, next)
+		err = checkLinkedURL(pageURL, next)
+		if err != nil {
+			return nil, cached, false, err
+		}
+	}
+	page := jsonIndexPage{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Next:         next,
+	}
+	return items, page, true, nil
+}
+
+// decodeJSONIndexPage reads a page of the index item by item instead of loading it in memory all at once.
+// the page is a json array of items or an object with the items in "items" and the url of the next page in "next".
+func decodeJSONIndexPage(r io.Reader) ([]ArticleIndexItem, string, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, "", err
+	}
+	if token == json.Delim('[') {
+		items, err := decodeJSONIndexItems(decoder)
+		return items, "", err
+	}
+	if token != json.Delim('{') {
+		return nil, "", fmt.Errorf("the index must be a json array or object, got %v", token)
+	}
+
+	items := []ArticleIndexItem{}
+	next := ""
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, "", err
+		}
+		switch token {
+		case "items":
+			token, err = decoder.Token()
+			if err != nil {
+				return nil, "", err
+			}
+			if token != json.Delim('[') {
+				return nil, "", fmt.Errorf("items must be a json array, got %v", token)
+			}
+			items, err = decodeJSONIndexItems(decoder)
+		case "next":
+			var nextURL *string
+			err = decoder.Decode(&nextURL)
+			if nextURL != nil {
+				next = *nextURL
+			}
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return items, next, nil
+}
+
+// decodeJSONIndexItems decodes the items of an array whose opening bracket has been read, up to and
+// including the closing bracket.
+func decodeJSONIndexItems(decoder *json.Decoder) ([]ArticleIndexItem, error) {
+	items := []ArticleIndexItem{}
+	for decoder.More() {
+		item := ArticleIndexItem{}
+		err := decoder.Decode(&item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	_, err := decoder.Token()
+	return items, err
+}
+
+// linkHeaderNext returns the url of the rel="next" link in the Link headers, as used by paginated APIs.
+func linkHeaderNext(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			for _, param := range parts[1:] {
+				param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+				if strings.EqualFold(param, `rel="next"`) || strings.EqualFold(param, "rel=next") {
+					return target
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Article fetches the full article json content from the site.
+func (s *jsonIndexSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	article := ArticleJSONData{}
+	jsonArticleData, err := fetchURL(s.client, item.URL)
+	if err != nil {
+		return article, err
+	}
+	err = json.Unmarshal(jsonArticleData, &article)
+	return article, err
+}
+
+// RestoreState remembers the validators of the pages seen in the last successful run.
+func (s *jsonIndexSource) RestoreState(state json.RawMessage) error {
+	saved := jsonIndexState{}
+	err := json.Unmarshal(state, &saved)
+	if err != nil {
+		return err
+	}
+	if saved.Pages != nil {
+		s.pages = saved.Pages
+	}
+	return nil
+}
+
+// State returns the validators of the pages seen in this run. pages that are no longer part of the index are dropped.
+func (s *jsonIndexSource) State() (json.RawMessage, error) {
+	return json.Marshal(jsonIndexState{Pages: s.seen})
+}
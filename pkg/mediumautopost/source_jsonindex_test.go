@@ -0,0 +1,338 @@
+package mediumautopost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestJSONIndexSourceReadsLocalFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "posts", "one"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "index.json"), []byte(`[{"url":"posts/one/medium.json","id":"one"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "posts", "one", "medium.json"), []byte(`{"title":"One","contentFormat":"html","content":"<p>one</p>"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{WebsiteJSONIndexURL: filepath.Join(dir, "index.json")}
+	source, err := newJSONIndexSource(config, testHTTPClient(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := source.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 || index[0].URL != fileURLOf(t, filepath.Join(dir, "posts", "one", "medium.json")) {
+		t.Fatalf("Index() = %+v, want the article resolved relative to the index", index)
+	}
+	article, err := source.Article(index[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "One" {
+		t.Fatalf("Article() = %+v", article)
+	}
+}
+
+func TestJSONIndexSourceRefusesLocalFilesFromRemoteIndex(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.json")
+	err := ioutil.WriteFile(secret, []byte(`{"title":"secret","content":"secret"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"article": fmt.Sprintf(`[{"url":%q,"id":"secret"}]`, fileURLOf(t, secret)),
+		"next":    fmt.Sprintf(`{"items":[],"next":%q}`, fileURLOf(t, secret)),
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, body)
+			}))
+			defer server.Close()
+
+			// the client could read the file, the source must refuse to ask for it
+			client := testHTTPClient(t, Config{WebsiteJSONIndexURL: filepath.Join(filepath.Dir(secret), "index.json")})
+			source, err := newJSONIndexSource(Config{WebsiteJSONIndexURL: server.URL + "/index.json"}, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := source.Index()
+			if err == nil {
+				t.Fatalf("Index() = %+v, want an error for the local file in a remote index", index)
+			}
+		})
+	}
+}
+
+// testIndexPage is one page of a paginated json index served by testIndexServer.
+type testIndexPage struct {
+	body         string
+	link         string // the Link header
+	etag         string
+	lastModified string
+}
+
+// testIndexServer serves the pages by path and answers conditional requests with 304 like a static site host.
+// the articles it links to are served too. it counts the requests per path.
+type testIndexServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	pages    map[string]testIndexPage
+	requests map[string]int
+}
+
+func newTestIndexServer(t *testing.T, pages map[string]testIndexPage) *testIndexServer {
+	t.Helper()
+	s := &testIndexServer{pages: pages, requests: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests[r.URL.Path]++
+		if strings.HasPrefix(r.URL.Path, "/posts/") {
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/posts/"), ".json")
+			fmt.Fprintf(w, `{"title":"Article %s","contentFormat":"markdown","content":"content of %s"}`, id, id)
+			return
+		}
+		page, ok := s.pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if (page.etag != "" && r.Header.Get("If-None-Match") == page.etag) ||
+			(page.lastModified != "" && r.Header.Get("If-Modified-Since") == page.lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if page.link != "" {
+			w.Header().Set("Link", page.link)
+		}
+		if page.etag != "" {
+			w.Header().Set("ETag", page.etag)
+		}
+		if page.lastModified != "" {
+			w.Header().Set("Last-Modified", page.lastModified)
+		}
+		fmt.Fprint(w, page.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testIndexServer) requestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func (s *testIndexServer) setPage(path string, page testIndexPage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[path] = page
+}
+
+func indexIDs(items []ArticleIndexItem) string {
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestJSONIndexSourcePagination(t *testing.T) {
+	tests := map[string]map[string]testIndexPage{
+		"link header": {
+			"/index.json":  {body: `[{"url":"posts/one.json","id":"one"}]`, link: `<page/2.json>; rel="next", </index.json>; rel="first"`},
+			"/page/2.json": {body: `[{"url":"../posts/two.json","id":"two"}]`, link: `</page/3.json>; rel=next`},
+			"/page/3.json": {body: `[{"url":"/posts/three.json","id":"three"}]`, link: `</index.json>; rel="first"`},
+		},
+		"items and next": {
+			"/index.json":  {body: `{"items":[{"url":"posts/one.json","id":"one"}],"next":"page/2.json"}`},
+			"/page/2.json": {body: `{"next":"/page/3.json","items":[{"url":"../posts/two.json","id":"two"}],"total":3}`},
+			"/page/3.json": {body: `{"items":[{"url":"/posts/three.json","id":"three"}],"next":null}`},
+		},
+	}
+	for name, pages := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestIndexServer(t, pages)
+			source, err := newJSONIndexSource(Config{WebsiteJSONIndexURL: server.URL + "/index.json"}, http.Client{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := source.Index()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if indexIDs(index) != "one,two,three" {
+				t.Fatalf("Index() = %+v, want the items of the three pages", index)
+			}
+			for _, item := range index {
+				if item.URL != server.URL+"/posts/"+item.ID+".json" {
+					t.Fatalf("item %s has url %s, want it resolved relative to its page", item.ID, item.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONIndexSourceSkipsUnchangedPages(t *testing.T) {
+	server := newTestIndexServer(t, map[string]testIndexPage{
+		"/index.json":  {body: `{"items":[{"url":"posts/one.json","id":"one"}],"next":"page/2.json"}`, etag: `"v1"`},
+		"/page/2.json": {body: `{"items":[{"url":"../posts/two.json","id":"two"}]}`, lastModified: "Mon, 02 Jan 2006 15:04:05 GMT"},
+	})
+	config := Config{WebsiteJSONIndexURL: server.URL + "/index.json"}
+	run := func(state json.RawMessage) ([]ArticleIndexItem, json.RawMessage) {
+		t.Helper()
+		source, err := newJSONIndexSource(config, http.Client{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != nil {
+			err = source.(StatefulSource).RestoreState(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		index, err := source.Index()
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, err = source.(StatefulSource).State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index, state
+	}
+
+	index, state := run(nil)
+	if indexIDs(index) != "one,two" {
+		t.Fatalf("first Index() = %+v", index)
+	}
+
+	// both pages are answered with 304, there is nothing new. the next pages are still known from the state
+	index, state = run(state)
+	if len(index) != 0 || server.requestCount("/page/2.json") != 2 {
+		t.Fatalf("Index() of unchanged pages = %+v, want nothing after asking for both pages", index)
+	}
+
+	// only the changed page is read
+	server.setPage("/index.json", testIndexPage{body: `{"items":[{"url":"posts/three.json","id":"three"},{"url":"posts/one.json","id":"one"}],"next":"page/2.json"}`, etag: `"v2"`})
+	index, state = run(state)
+	if indexIDs(index) != "three,one" {
+		t.Fatalf("Index() after the first page changed = %+v, want only its items", index)
+	}
+	saved := jsonIndexState{}
+	err := json.Unmarshal(state, &saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Pages[server.URL+"/index.json"].ETag != `"v2"` || saved.Pages[server.URL+"/page/2.json"].Next != "" || len(saved.Pages) != 2 {
+		t.Fatalf("state = %s, want the new etag of the first page", state)
+	}
+}
+
+func TestJSONIndexSourceRefusesLoops(t *testing.T) {
+	server := newTestIndexServer(t, map[string]testIndexPage{
+		"/index.json":  {body: `[{"url":"posts/one.json","id":"one"}]`, link: `</page/2.json>; rel="next"`},
+		"/page/2.json": {body: `{"items":[{"url":"/posts/two.json","id":"two"}],"next":"/index.json"}`},
+	})
+	source, err := newJSONIndexSource(Config{WebsiteJSONIndexURL: server.URL + "/index.json"}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := source.Index()
+	if err == nil || !strings.Contains(err.Error(), "loop") {
+		t.Fatalf("Index() = %+v, %v, want an error for the loop", index, err)
+	}
+	if server.requestCount("/index.json") != 1 {
+		t.Fatalf("the first page was read %v times", server.requestCount("/index.json"))
+	}
+}
+
+func TestJSONIndexStateWaitsForFailures(t *testing.T) {
+	server := newTestIndexServer(t, map[string]testIndexPage{
+		"/index.json": {body: `[{"url":"posts/one.json","id":"one"},{"url":"posts/two.json","id":"two"}]`, etag: `"v1"`},
+	})
+	medium := newTestMedium(t)
+	failing := true
+	medium.respond = func(w http.ResponseWriter, r *http.Request) bool {
+		if !failing || !strings.Contains(r.URL.Path, "/posts") {
+			return false
+		}
+		request := createPostRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Title != "Article two" {
+			return false
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"errors":[{"message":"bad content","code":6026}]}`)
+		return true
+	}
+	config := Config{
+		MediumEndpointPrefix: medium.URL,
+		MediumBearerToken:    "token",
+		MediumPublishStatus:  defaultPublishStatus,
+		WebsiteJSONIndexURL:  server.URL + "/index.json",
+		JournalPath:          filepath.Join(t.TempDir(), "journal.jsonl"),
+		RetryMaxAttempts:     defaultRetryMaxAttempts,
+		// the failed article is due again on the next run
+		RetryDelay: 1,
+	}
+	store := &memoryStore{}
+
+	err := publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ := store.Load()
+	if len(status.Failures) != 1 || status.Sources[string(JSONIndex)] != nil {
+		t.Fatalf("status after a failure = %+v, want the failure without the source state", status)
+	}
+
+	// the index is read again in full, the failed article is posted and only then the state moves forward
+	medium.mu.Lock()
+	failing = false
+	medium.mu.Unlock()
+	err = publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ = store.Load()
+	if len(status.Failures) != 0 || status.Sources[string(JSONIndex)] == nil || medium.postCount() != 2 {
+		t.Fatalf("status after the retry = %+v with %v posts, want the source state and both articles posted", status, medium.postCount())
+	}
+
+	// now the unchanged index is answered with 304 and no article is fetched again
+	err = publish(context.Background(), config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.requestCount("/index.json") != 3 || server.requestCount("/posts/one.json") != 1 || medium.postCount() != 2 {
+		t.Fatalf("the index was read %v times and article one %v times, posted %v", server.requestCount("/index.json"), server.requestCount("/posts/one.json"), medium.postCount())
+	}
+}
+
+func fileURLOf(t *testing.T, path string) string {
+	t.Helper()
+	u, err := fileURL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
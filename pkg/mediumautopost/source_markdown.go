@@ -0,0 +1,303 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Markdown is the source type for reading articles straight from a directory of markdown files at CONTENT_DIR.
+const Markdown SourceType = "MARKDOWN"
+
+// markdownSource reads every markdown file under a content directory, e.g. a hugo site's content/posts.
+// the files are parsed by Index and kept, so Article does not read anything.
+type markdownSource struct {
+	contentDir string
+	// section is the name of the content directory as configured, the first part of the IDs
+	section     string
+	siteBaseURL string
+	articles    map[string]ArticleJSONData
+}
+
+// frontMatter is the part of a post's front matter we use. keys are matched case insensitively like hugo does.
+type frontMatter struct {
+	Title        string
+	Tags         []string
+	Slug         string
+	Draft        bool
+	Date         time.Time
+	CanonicalURL string
+	Lang         string
+	Syndicate    *bool
+}
+
+// markdownPost is a parsed markdown file.
+type markdownPost struct {
+	frontMatter
+	Body string
+}
+
+func newMarkdownSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.ContentDir == "" {
+		return nil, errors.New("SOURCE_TYPE is MARKDOWN but CONTENT_DIR is empty")
+	}
+	return &markdownSource{
+		contentDir:  c.ContentDir,
+		section:     filepath.Base(filepath.Clean(c.ContentDir)),
+		siteBaseURL: strings.TrimRight(c.SiteBaseURL, "/"),
+		articles:    map[string]ArticleJSONData{},
+	}, nil
+}
+
+// Index walks the content directory and turns every published post into an article. drafts and posts dated
+// in the future are skipped, as are hugo's _index.md list pages.
+func (s *markdownSource) Index() ([]ArticleIndexItem, error) {
+	index := []ArticleIndexItem{}
+	now := time.Now()
+	err := filepath.Walk(s.contentDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isMarkdownPost(file) {
+			return nil
+		}
+		post, item, err := s.readPost(file)
+		if err != nil {
+			return err
+		}
+		if !isPublished(file, post, now) {
+			return nil
+		}
+		index = append(index, item)
+		return nil
+	})
+	if err != nil {
+		return []ArticleIndexItem{}, err
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i].ID < index[j].ID })
+
+	log.Printf("found content directory containing a total of %v articles", len(index))
+	return index, nil
+}
+
+// readPost parses a markdown file and keeps the article for Article. it returns the post and its index item.
+func (s *markdownSource) readPost(file string) (markdownPost, ArticleIndexItem, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return markdownPost{}, ArticleIndexItem{}, err
+	}
+	post, err := parseMarkdownPost(data)
+	if err != nil {
+		return post, ArticleIndexItem{}, fmt.Errorf("%s: %v", file, err)
+	}
+
+	id, err := s.postID(file, post)
+	if err != nil {
+		return post, ArticleIndexItem{}, err
+	}
+	canonicalURL := post.CanonicalURL
+	if canonicalURL == "" && s.siteBaseURL != "" {
+		canonicalURL = s.siteBaseURL + "/" + id + "/"
+	}
+	s.articles[id] = ArticleJSONData{
+		Title:         post.Title,
+		ContentFormat: "markdown",
+		Content:       post.Body,
+		CanonicalURL:  canonicalURL,
+		Tags:          post.Tags,
+	}
+	item := ArticleIndexItem{
+		URL:       canonicalURL,
+		ID:        id,
+		Section:   strings.Split(id, "/")[0],
+		Tags:      post.Tags,
+		Lang:      post.Lang,
+		Syndicate: post.Syndicate,
+	}
+	if !post.Date.IsZero() {
+		item.Date = post.Date.Format(time.RFC3339)
+	}
+	return post, item, nil
+}
+
+// Article returns the article read from the content directory by Index.
+func (s *markdownSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	article, ok := s.articles[item.ID]
+	if !ok {
+		return article, fmt.Errorf("article %s is not in %s", item.ID, s.contentDir)
+	}
+	return article, nil
+}
+
+// postID derives a stable ID from where the post lives, the same way hugo builds its url: the name of the
+// content directory, the sub directories and the slug (or the file name, or the bundle name for index.md),
+// e.g. content/posts/tutorials/my-post.md is posts/tutorials/my-post. with SITE_BASE_URL set this is also the
+// path of the canonical url. moving the file to another directory, or renaming it without a slug, changes the ID.
+func (s *markdownSource) postID(file string, post markdownPost) (string, error) {
+	rel, err := filepath.Rel(s.contentDir, file)
+	if err != nil {
+		return "", err
+	}
+	dir, name := filepath.Split(rel)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if name == "index" && dir != "" {
+		dir, name = filepath.Split(filepath.Clean(dir))
+	}
+	if post.Slug != "" {
+		name = post.Slug
+	}
+	return path.Join(s.section, filepath.ToSlash(dir), name), nil
+}
+
+// isMarkdownPost reports whether the file is a markdown post. hugo's _index.md list pages are not posts.
+func isMarkdownPost(file string) bool {
+	if strings.HasPrefix(filepath.Base(file), "_index.") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// isPublished reports whether the post should be posted now, drafts and posts dated in the future are not.
+func isPublished(file string, post markdownPost, now time.Time) bool {
+	if post.Draft {
+		log.Printf("skipping draft %s", file)
+		return false
+	}
+	if post.Date.After(now) {
+		log.Printf("skipping %s, it is dated in the future (%s)", file, post.Date.Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
+// parseMarkdownPost splits a markdown file into its front matter and body. front matter between --- lines is
+// yaml, between +++ lines it is toml. a file without front matter is all body.
+func parseMarkdownPost(data []byte) (markdownPost, error) {
+	post := markdownPost{}
+	text := strings.Replace(string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))), "\r\n", "\n", -1)
+
+	delimiter := ""
+	switch {
+	case strings.HasPrefix(text, "---\n"):
+		delimiter = "---"
+	case strings.HasPrefix(text, "+++\n"):
+		delimiter = "+++"
+	default:
+		post.Body = text
+		return post, nil
+	}
+	// the front matter ends at the next line that is only the delimiter
+	rest := text[len(delimiter):]
+	end := strings.Index(rest+"\n", "\n"+delimiter+"\n")
+	if end < 0 {
+		return post, fmt.Errorf("front matter is not closed with %s", delimiter)
+	}
+	header := rest[:end]
+	if body := end + len(delimiter) + 2; body < len(rest) {
+		post.Body = strings.TrimLeft(rest[body:], "\n")
+	}
+
+	values := map[string]interface{}{}
+	var err error
+	if delimiter == "---" {
+		err = yaml.Unmarshal([]byte(header), &values)
+	} else {
+		_, err = toml.Decode(header, &values)
+	}
+	if err != nil {
+		return post, fmt.Errorf("invalid front matter: %v", err)
+	}
+	post.frontMatter, err = parseFrontMatter(values)
+	return post, err
+}
+
+// parseFrontMatter picks the fields we need out of the decoded front matter.
+func parseFrontMatter(values map[string]interface{}) (frontMatter, error) {
+	fm := frontMatter{}
+	for key, value := range values {
+		var err error
+		switch strings.ToLower(key) {
+		case "title":
+			fm.Title = strings.TrimSpace(fmt.Sprint(value))
+		case "slug":
+			fm.Slug = strings.Trim(strings.TrimSpace(fmt.Sprint(value)), "/")
+		case "canonicalurl":
+			fm.CanonicalURL = strings.TrimSpace(fmt.Sprint(value))
+		case "lang":
+			fm.Lang = strings.TrimSpace(fmt.Sprint(value))
+		case "draft":
+			draft, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("draft must be true or false, got %v", value)
+			}
+			fm.Draft = draft
+		case "syndicate":
+			syndicate, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("syndicate must be true or false, got %v", value)
+			}
+			fm.Syndicate = &syndicate
+		case "tags":
+			fm.Tags, err = frontMatterStrings(value)
+		case "date":
+			fm.Date, err = parseLooseTime(value)
+		}
+		if err != nil {
+			return fm, err
+		}
+	}
+	return fm, nil
+}
+
+// frontMatterStrings accepts a list of tags or a single tag.
+func frontMatterStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		tags := []string{}
+		for _, tag := range v {
+			tags = append(tags, fmt.Sprint(tag))
+		}
+		return tags, nil
+	}
+	return nil, fmt.Errorf("tags must be a list, got %v", value)
+}
+
+// parseLooseTime accepts the dates yaml and toml decode natively as well as dates written as strings,
+// with or without a time and a timezone.
+func parseLooseTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		layouts := []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", time.RFC1123Z, time.RFC1123}
+		for _, layout := range layouts {
+			t, err := time.ParseInLocation(layout, strings.TrimSpace(v), time.Local)
+			if err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v", value)
+}
+
+func init() {
+	RegisterArticleSource(Markdown, newMarkdownSource)
+}
@@ -0,0 +1,197 @@
+package mediumautopost
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFixtures writes the files, by path relative to dir, creating the directories they are in.
+func writeFixtures(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(file, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMarkdownSourceIndex(t *testing.T) {
+	future := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	dir := filepath.Join(t.TempDir(), "posts")
+	writeFixtures(t, dir, map[string]string{
+		"yaml.md":                   "---\ntitle: YAML post\ntags: [go, cloud]\ndate: 2022-05-01T10:00:00Z\nlang: en\n---\n\nyaml body\n",
+		"toml.md":                   "+++\ntitle = \"TOML post\"\ntags = [\"rust\"]\ndate = 2022-05-02T10:00:00Z\n+++\ntoml body\n",
+		"bundle/index.md":           "---\ntitle: Bundle\n---\nbundle body\n",
+		"tutorials/deep/index.md":   "---\ntitle: Deep bundle\n---\ndeep body\n",
+		"tutorials/renamed-file.md": "---\ntitle: Slugged\nslug: /the-slug/\n---\nslug body\n",
+		"draft.md":                  "---\ntitle: Draft\ndraft: true\n---\ndraft body\n",
+		"future.md":                 "---\ntitle: Future\ndate: " + future + "\n---\nfuture body\n",
+		"crlf.md":                   "\xef\xbb\xbf---\r\ntitle: Windows\r\nTags: windows\r\n---\r\nline one\r\nline two\r\n",
+		"plain.markdown":            "no front matter\n",
+		"_index.md":                 "---\ntitle: Posts\n---\nlist page\n",
+		"notes.txt":                 "not a post",
+	})
+	source, err := newMarkdownSource(Config{ContentDir: dir, SiteBaseURL: "https://example.com/"}, http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := source.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "posts/bundle,posts/crlf,posts/plain,posts/toml,posts/tutorials/deep,posts/tutorials/the-slug,posts/yaml"
+	if got := indexIDs(index); got != want {
+		t.Fatalf("Index() = %s, want %s", got, want)
+	}
+
+	articles := map[string]ArticleJSONData{}
+	items := map[string]ArticleIndexItem{}
+	for _, item := range index {
+		article, err := source.Article(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		articles[item.ID] = article
+		items[item.ID] = item
+	}
+	yaml := articles["posts/yaml"]
+	if yaml.Title != "YAML post" || yaml.Content != "yaml body\n" || strings.Join(yaml.Tags, ",") != "go,cloud" || yaml.CanonicalURL != "https://example.com/posts/yaml/" {
+		t.Fatalf("yaml post = %+v", yaml)
+	}
+	if item := items["posts/yaml"]; item.Date != "2022-05-01T10:00:00Z" || item.Section != "posts" || item.Lang != "en" || item.URL != yaml.CanonicalURL {
+		t.Fatalf("yaml index item = %+v", item)
+	}
+	if toml := articles["posts/toml"]; toml.Title != "TOML post" || toml.Content != "toml body\n" || strings.Join(toml.Tags, ",") != "rust" {
+		t.Fatalf("toml post = %+v", toml)
+	}
+	if crlf := articles["posts/crlf"]; crlf.Title != "Windows" || crlf.Content != "line one\nline two\n" || strings.Join(crlf.Tags, ",") != "windows" {
+		t.Fatalf("crlf post = %+v", crlf)
+	}
+	if slug := articles["posts/tutorials/the-slug"]; slug.CanonicalURL != "https://example.com/posts/tutorials/the-slug/" {
+		t.Fatalf("slugged post = %+v", slug)
+	}
+}
+
+func TestParseMarkdownPost(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		title string
+		body  string
+		err   string
+	}{
+		{name: "yaml", in: "---\ntitle: Hello\n---\nbody\n", title: "Hello", body: "body\n"},
+		{name: "toml", in: "+++\ntitle = \"Hello\"\n+++\nbody\n", title: "Hello", body: "body\n"},
+		{name: "bom", in: "\xef\xbb\xbf---\ntitle: Hello\n---\nbody\n", title: "Hello", body: "body\n"},
+		{name: "crlf", in: "---\r\ntitle: Hello\r\n---\r\n\r\nbody\r\n", title: "Hello", body: "body\n"},
+		{name: "bom and crlf toml", in: "\xef\xbb\xbf+++\r\ntitle = \"Hello\"\r\n+++\r\nbody", title: "Hello", body: "body"},
+		{name: "no body", in: "---\ntitle: Hello\n---", title: "Hello"},
+		{name: "delimiter inside the body", in: "---\ntitle: Hello\n---\none\n---\ntwo\n", title: "Hello", body: "one\n---\ntwo\n"},
+		{name: "dashes in a value", in: "---\ntitle: a---b\n---\nbody\n", title: "a---b", body: "body\n"},
+		{name: "no front matter", in: "# Hello\n\nbody\n", body: "# Hello\n\nbody\n"},
+		{name: "not closed", in: "---\ntitle: Hello\nbody\n", err: "not closed"},
+		{name: "invalid yaml", in: "---\ntitle: [Hello\n---\nbody\n", err: "invalid front matter"},
+		{name: "invalid toml", in: "+++\ntitle = Hello\n+++\nbody\n", err: "invalid front matter"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			post, err := parseMarkdownPost([]byte(test.in))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("parseMarkdownPost() = %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if post.Title != test.title || post.Body != test.body {
+				t.Fatalf("parseMarkdownPost() = %q, %q, want %q, %q", post.Title, post.Body, test.title, test.body)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	no := false
+	tests := []struct {
+		name string
+		in   string
+		want frontMatter
+		err  string
+	}{
+		{name: "yaml", in: "---\nTitle: \" Hello \"\nTAGS: [go, 2022]\nslug: /hello/\ncanonicalURL: https://example.com/hello/\nlang: fr\nsyndicate: false\n---\n",
+			want: frontMatter{Title: "Hello", Tags: []string{"go", "2022"}, Slug: "hello", CanonicalURL: "https://example.com/hello/", Lang: "fr", Syndicate: &no}},
+		{name: "toml", in: "+++\ntitle = \"Hello\"\ntags = \"go\"\ndraft = true\n+++\n", want: frontMatter{Title: "Hello", Tags: []string{"go"}, Draft: true}},
+		{name: "yaml date", in: "---\ndate: 2022-05-01T10:00:00+02:00\n---\n", want: frontMatter{Date: time.Date(2022, 5, 1, 8, 0, 0, 0, time.UTC)}},
+		{name: "yaml quoted date", in: "---\ndate: \"2022-05-01T10:00:00Z\"\n---\n", want: frontMatter{Date: time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)}},
+		{name: "toml date", in: "+++\ndate = 2022-05-01T10:00:00Z\n+++\n", want: frontMatter{Date: time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)}},
+		{name: "toml local date", in: "+++\ndate = 2022-05-01\n+++\n", want: frontMatter{Date: time.Date(2022, 5, 1, 0, 0, 0, 0, time.Local)}},
+		{name: "unknown keys", in: "---\ntitle: Hello\nweight: 3\nparams: {a: b}\n---\n", want: frontMatter{Title: "Hello"}},
+		{name: "draft as a string", in: "---\ndraft: \"yes\"\n---\n", err: "draft must be true or false"},
+		{name: "syndicate as a number", in: "+++\nsyndicate = 1\n+++\n", err: "syndicate must be true or false"},
+		{name: "tags as a map", in: "---\ntags: {a: b}\n---\n", err: "tags must be a list"},
+		{name: "invalid date", in: "---\ndate: someday\n---\n", err: "invalid date"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			post, err := parseMarkdownPost([]byte(test.in))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("parseMarkdownPost() = %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, want := post.frontMatter, test.want
+			if got.Title != want.Title || strings.Join(got.Tags, ",") != strings.Join(want.Tags, ",") || got.Slug != want.Slug ||
+				got.Draft != want.Draft || !got.Date.Equal(want.Date) || got.CanonicalURL != want.CanonicalURL || got.Lang != want.Lang ||
+				(got.Syndicate == nil) != (want.Syndicate == nil) || (got.Syndicate != nil && *got.Syndicate != *want.Syndicate) {
+				t.Fatalf("front matter = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestMarkdownPostID(t *testing.T) {
+	dir := filepath.Join("site", "content", "posts")
+	source := &markdownSource{contentDir: dir, section: "posts"}
+	tests := []struct {
+		file string
+		slug string
+		want string
+	}{
+		{"hello.md", "", "posts/hello"},
+		{"hello.markdown", "", "posts/hello"},
+		{"tutorials/hello.md", "", "posts/tutorials/hello"},
+		{"bundle/index.md", "", "posts/bundle"},
+		{"tutorials/bundle/index.md", "", "posts/tutorials/bundle"},
+		{"index.md", "", "posts/index"},
+		{"hello.md", "other", "posts/other"},
+		{"bundle/index.md", "other", "posts/other"},
+		{"tutorials/hello.md", "other", "posts/tutorials/other"},
+	}
+	for _, test := range tests {
+		post := markdownPost{frontMatter: frontMatter{Slug: test.slug}}
+		got, err := source.postID(filepath.Join(dir, filepath.FromSlash(test.file)), post)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("postID(%s, slug %q) = %s, want %s", test.file, test.slug, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Sitemap is the source type for reading articles from the pages listed in the sitemap at SITEMAP_URL.
+const Sitemap SourceType = "SITEMAP"
+
+// sitemapSource lists the pages in a sitemap (following sitemap indexes) and extracts the article from the html
+// of each page, so it works with sites whose templates we can't change.
+type sitemapSource struct {
+	client      http.Client
+	sitemapURL  string
+	pathPattern *regexp.Regexp
+}
+
+// sitemapDocument is either a <urlset> of pages or a <sitemapindex> of other sitemaps, both list <loc>s.
+type sitemapDocument struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapSkippedElements are left out of the article body, they are page chrome rather than content.
+var sitemapSkippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Iframe:   true,
+}
+
+func newSitemapSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.SitemapURL == "" {
+		return nil, errors.New("SOURCE_TYPE is SITEMAP but SITEMAP_URL is empty")
+	}
+	source := &sitemapSource{client: client, sitemapURL: c.SitemapURL}
+	if c.SitemapPathPattern != "" {
+		pattern, err := regexp.Compile(c.SitemapPathPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SITEMAP_PATH_PATTERN: %v", err)
+		}
+		source.pathPattern = pattern
+	}
+	return source, nil
+}
+
+// Index walks the sitemap and every sitemap it points to, and keeps the pages whose path matches
+// SITEMAP_PATH_PATTERN. the page url is the article ID.
+func (s *sitemapSource) Index() ([]ArticleIndexItem, error) {
+	index := []ArticleIndexItem{}
+	seen := map[string]bool{}
+	queue := []string{s.sitemapURL}
+	for len(queue) > 0 {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if seen[sitemapURL] {
+			continue
+		}
+		seen[sitemapURL] = true
+
+		doc, err := s.fetchSitemap(sitemapURL)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		for _, sitemap := range doc.Sitemaps {
+			loc := strings.TrimSpace(sitemap.Loc)
+			err = checkLinkedURL(sitemapURL, loc)
+			if err != nil {
+				return []ArticleIndexItem{}, err
+			}
+			queue = append(queue, loc)
+		}
+		for _, page := range doc.URLs {
+			loc := strings.TrimSpace(page.Loc)
+			err = checkLinkedURL(sitemapURL, loc)
+			if err != nil {
+				return []ArticleIndexItem{}, err
+			}
+			if !s.matches(loc) {
+				continue
+			}
+			index = append(index, ArticleIndexItem{URL: loc, ID: loc})
+		}
+	}
+
+	log.Printf("found sitemap containing a total of %v articles", len(index))
+	return index, nil
+}
+
+// Article fetches the page and extracts the article from its html.
+func (s *sitemapSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	data, err := fetchURL(s.client, item.URL)
+	if err != nil {
+		return ArticleJSONData{}, err
+	}
+	return extractArticle(item.URL, data)
+}
+
+func (s *sitemapSource) matches(loc string) bool {
+	if s.pathPattern == nil {
+		return true
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return false
+	}
+	return s.pathPattern.MatchString(u.Path)
+}
+
+// fetchSitemap downloads and parses a sitemap. sitemaps served as .xml.gz files are gunzipped.
+func (s *sitemapSource) fetchSitemap(sitemapURL string) (sitemapDocument, error) {
+	doc := sitemapDocument{}
+	data, err := fetchURL(s.client, sitemapURL)
+	if err != nil {
+		return doc, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return doc, err
+		}
+		data, err = ioutil.ReadAll(reader)
+		if err != nil {
+			return doc, err
+		}
+	}
+	err = xml.Unmarshal(data, &doc)
+	if err != nil {
+		return doc, fmt.Errorf("%s: %v", sitemapURL, err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return doc, fmt.Errorf("%s is not a sitemap, the root element is <%s>", sitemapURL, doc.XMLName.Local)
+	}
+	return doc, nil
+}
+
+// extractArticle pulls the article out of an html page:
+//   - the title is og:title, or the first <h1> of the article, or the <title>
+//   - the content is the inner html of <article>, or <main>, or the <body>, without scripts and page chrome
+//   - the tags are the article:tag meta tags
+//   - the canonical url is <link rel=canonical>, or the page url
+func extractArticle(pageURL string, data []byte) (ArticleJSONData, error) {
+	article := ArticleJSONData{ContentFormat: "html", CanonicalURL: pageURL, Tags: []string{}}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return article, err
+	}
+
+	var pageTitle, ogTitle string
+	var articleNode, mainNode, bodyNode *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if pageTitle == "" {
+					pageTitle = textContent(n)
+				}
+			case atom.Meta:
+				property := attr(n, "property")
+				if property == "" {
+					property = attr(n, "name")
+				}
+				switch property {
+				case "og:title":
+					ogTitle = attr(n, "content")
+				case "article:tag":
+					article.Tags = append(article.Tags, strings.TrimSpace(attr(n, "content")))
+				}
+			case atom.Link:
+				if strings.EqualFold(attr(n, "rel"), "canonical") && attr(n, "href") != "" {
+					article.CanonicalURL = resolveURL(pageURL, attr(n, "href"))
+				}
+			case atom.Article:
+				if articleNode == nil {
+					articleNode = n
+				}
+			case atom.Main:
+				if mainNode == nil {
+					mainNode = n
+				}
+			case atom.Body:
+				bodyNode = n
+			}
+			if n.DataAtom != atom.Main && attr(n, "role") == "main" && mainNode == nil {
+				mainNode = n
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	contentNode := articleNode
+	if contentNode == nil {
+		contentNode = mainNode
+	}
+	if contentNode == nil {
+		contentNode = bodyNode
+	}
+	if contentNode == nil {
+		return article, fmt.Errorf("no article content found in %s", pageURL)
+	}
+
+	article.Title = strings.TrimSpace(ogTitle)
+	if article.Title == "" {
+		if h1 := findElement(contentNode, atom.H1); h1 != nil {
+			article.Title = textContent(h1)
+		}
+	}
+	if article.Title == "" {
+		article.Title = pageTitle
+	}
+
+	var content bytes.Buffer
+	for child := contentNode.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && sitemapSkippedElements[child.DataAtom] {
+			continue
+		}
+		if child.Type == html.CommentNode {
+			continue
+		}
+		pruneElements(pageURL, child)
+		err = html.Render(&content, child)
+		if err != nil {
+			return article, err
+		}
+	}
+	article.Content = strings.TrimSpace(content.String())
+	return article, nil
+}
+
+// pruneElements removes the skipped elements and comments below n, and makes the links and images absolute
+// so they still work when the content is posted somewhere else.
+func pruneElements(pageURL string, n *html.Node) {
+	resolveLinks(pageURL, n)
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.CommentNode || (child.Type == html.ElementNode && sitemapSkippedElements[child.DataAtom]) {
+			n.RemoveChild(child)
+		} else {
+			pruneElements(pageURL, child)
+		}
+		child = next
+	}
+}
+
+// resolveLinks resolves the src of an <img> or the href of an <a> against the page url.
+func resolveLinks(pageURL string, n *html.Node) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	key := ""
+	switch n.DataAtom {
+	case atom.Img:
+		key = "src"
+	case atom.A:
+		key = "href"
+	default:
+		return
+	}
+	for i, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) && a.Val != "" && !strings.HasPrefix(a.Val, "#") {
+			n.Attr[i].Val = resolveURL(pageURL, a.Val)
+		}
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textContent returns the text below n with the whitespace collapsed.
+func textContent(n *html.Node) string {
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// resolveURL resolves a possibly relative reference against base.
+func resolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+func init() {
+	RegisterArticleSource(Sitemap, newSitemapSource)
+}
@@ -0,0 +1,35 @@
+package mediumautopost
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractArticleResolvesLinks(t *testing.T) {
+	page := `<html><head><title>Page</title></head><body>
+<nav><a href="/">home</a></nav>
+<article>
+<h1>Post</h1>
+<p><img src="images/cover.png"> <a href="/posts/other/">other</a> <a href="#notes">notes</a>
+<a href="https://elsewhere.example/x">elsewhere</a> <img src="//cdn.example/pic.jpg"></p>
+</article>
+</body></html>`
+	article, err := extractArticle("https://example.com/posts/post/", []byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<img src="https://example.com/posts/post/images/cover.png"/>`,
+		`<a href="https://example.com/posts/other/">other</a>`,
+		`<a href="#notes">notes</a>`,
+		`<a href="https://elsewhere.example/x">elsewhere</a>`,
+		`<img src="https://cdn.example/pic.jpg"/>`,
+	} {
+		if !strings.Contains(article.Content, want) {
+			t.Errorf("content does not contain %s:\n%s", want, article.Content)
+		}
+	}
+	if strings.Contains(article.Content, "home") {
+		t.Errorf("content contains the nav:\n%s", article.Content)
+	}
+}
@@ -0,0 +1,183 @@
+package mediumautopost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Wordpress is the source type for reading articles from the REST API of a WordPress site at WORDPRESS_URL.
+const Wordpress SourceType = "WORDPRESS"
+
+// wordpressPageSize is the number of posts fetched per request, the most the API allows.
+const wordpressPageSize = 100
+
+// wordpressSource pages through /wp-json/wp/v2/posts. the posts are embedded with their tags and featured
+// media, so they are kept from Index and Article does not fetch anything.
+type wordpressSource struct {
+	client   http.Client
+	siteURL  string
+	username string
+	password string
+	articles map[string]ArticleJSONData
+}
+
+// wordpressPost is the part of a post from the REST API we need.
+type wordpressPost struct {
+	ID      int    `json:"id"`
+	Link    string `json:"link"`
+	DateGMT string `json:"date_gmt"`
+	Title   struct {
+		Rendered string `json:"rendered"`
+	} `json:"title"`
+	Content struct {
+		Rendered string `json:"rendered"`
+	} `json:"content"`
+	Embedded struct {
+		FeaturedMedia []struct {
+			SourceURL string `json:"source_url"`
+			AltText   string `json:"alt_text"`
+		} `json:"wp:featuredmedia"`
+		Terms [][]struct {
+			Name     string `json:"name"`
+			Taxonomy string `json:"taxonomy"`
+		} `json:"wp:term"`
+	} `json:"_embedded"`
+}
+
+func newWordpressSource(c Config, client http.Client) (ArticleSource, error) {
+	if c.WordpressURL == "" {
+		return nil, errors.New("SOURCE_TYPE is WORDPRESS but WORDPRESS_URL is empty")
+	}
+	if (c.WordpressUsername == "") != (c.WordpressAppPassword == "") {
+		return nil, errors.New("WORDPRESS_USERNAME and WORDPRESS_APP_PASSWORD must be set together")
+	}
+	return &wordpressSource{
+		client:   client,
+		siteURL:  strings.TrimRight(c.WordpressURL, "/"),
+		username: c.WordpressUsername,
+		password: c.WordpressAppPassword,
+		articles: map[string]ArticleJSONData{},
+	}, nil
+}
+
+// Index fetches every published post, following X-WP-TotalPages. the WordPress post id is the article ID
+// and the post's permalink is the canonical url.
+func (s *wordpressSource) Index() ([]ArticleIndexItem, error) {
+	index := []ArticleIndexItem{}
+	for page, totalPages := 1, 1; page <= totalPages; page++ {
+		posts := []wordpressPost{}
+		var err error
+		totalPages, err = s.fetchPage(page, &posts)
+		if err != nil {
+			return []ArticleIndexItem{}, err
+		}
+		for _, post := range posts {
+			id := strconv.Itoa(post.ID)
+			article := post.article()
+			s.articles[id] = article
+			item := ArticleIndexItem{URL: post.Link, ID: id, Tags: article.Tags, Section: post.category()}
+			if post.DateGMT != "" {
+				item.Date = post.DateGMT + "Z"
+			}
+			index = append(index, item)
+		}
+	}
+
+	log.Printf("found wordpress site containing a total of %v articles", len(index))
+	return index, nil
+}
+
+// Article returns the article read from the REST API by Index.
+func (s *wordpressSource) Article(item ArticleIndexItem) (ArticleJSONData, error) {
+	article, ok := s.articles[item.ID]
+	if !ok {
+		return article, fmt.Errorf("article %s is not on %s", item.ID, s.siteURL)
+	}
+	return article, nil
+}
+
+// fetchPage gets one page of posts and returns the total number of pages. the application password is sent with
+// basic auth when it is set, which also lets the API return posts that are hidden from anonymous users.
+func (s *wordpressSource) fetchPage(page int, posts *[]wordpressPost) (int, error) {
+	url := fmt.Sprintf("%s/wp-json/wp/v2/posts?_embed=1&status=publish&orderby=date&order=asc&per_page=%d&page=%d",
+		s.siteURL, wordpressPageSize, page)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return 0, &apiError{Method: http.MethodGet, URL: url, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	err = json.Unmarshal(body, posts)
+	if err != nil {
+		return 0, err
+	}
+	totalPages, err := strconv.Atoi(resp.Header.Get("X-WP-TotalPages"))
+	if err != nil {
+		// without the header there is only the page we asked for
+		return page, nil
+	}
+	return totalPages, nil
+}
+
+// article turns a post into the payload for medium.com. the featured image, when there is one, is put
+// at the top of the content since medium has no separate field for it.
+func (p wordpressPost) article() ArticleJSONData {
+	content := p.Content.Rendered
+	if len(p.Embedded.FeaturedMedia) > 0 && p.Embedded.FeaturedMedia[0].SourceURL != "" {
+		media := p.Embedded.FeaturedMedia[0]
+		content = fmt.Sprintf("<figure><img src=\"%s\" alt=\"%s\"></figure>\n%s",
+			html.EscapeString(media.SourceURL), html.EscapeString(media.AltText), content)
+	}
+	tags := []string{}
+	for _, terms := range p.Embedded.Terms {
+		for _, term := range terms {
+			if term.Taxonomy == "post_tag" {
+				tags = append(tags, html.UnescapeString(term.Name))
+			}
+		}
+	}
+	return ArticleJSONData{
+		Title:         strings.TrimSpace(html.UnescapeString(p.Title.Rendered)),
+		ContentFormat: "html",
+		Content:       content,
+		CanonicalURL:  p.Link,
+		Tags:          tags,
+	}
+}
+
+// category returns the name of the post's first category, it is used as the section in the filtering rules.
+func (p wordpressPost) category() string {
+	for _, terms := range p.Embedded.Terms {
+		for _, term := range terms {
+			if term.Taxonomy == "category" {
+				return html.UnescapeString(term.Name)
+			}
+		}
+	}
+	return ""
+}
+
+func init() {
+	RegisterArticleSource(Wordpress, newWordpressSource)
+}
@@ -0,0 +1,160 @@
+package mediumautopost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StatusStore is where the list of articles already published to medium.com is kept between runs.
+// Load is called once at the start of a run and Save at the end with the full, updated status.
+// Load must understand every status version (see decodeStatus) and Save must write the current one.
+// Lock is called before Load and the returned release function is called when the run is finished.
+// a store that holds on to something, like a database connection, can also implement io.Closer,
+// Close is then called after the lock is released.
+type StatusStore interface {
+	Load() (Status, error)
+	Save(status Status) error
+	Lock() (release func() error, err error)
+}
+
+// articleLookup is implemented by status stores that can look published articles up by ID or url, e.g. with an
+// index, instead of loading all of them on every run. a run then calls loadState instead of Load, which returns the
+// status without its articles, and looks up the articles it needs. Save must keep the articles that are not in the
+// status it is given.
+type articleLookup interface {
+	loadState() (Status, error)
+	lookupArticles(ids, urls []string) ([]PublishedArticle, error)
+}
+
+// ErrStatusConflict is returned by Save when the stored status was changed by someone else since it was loaded.
+var ErrStatusConflict = errors.New("status was modified by another run")
+
+// StatusStoreFactory builds a StatusStore from the config. It is called once per run.
+type StatusStoreFactory func(c Config) (StatusStore, error)
+
+var (
+	statusStoresMu sync.RWMutex
+	statusStores   = map[StorageType]StatusStoreFactory{}
+)
+
+// RegisterStatusStore makes a status store backend available under the given storage type.
+// Library users can call this from an init function to add their own backend, then select it
+// by setting STORAGE_TYPE to the same name. Registering a name twice replaces the previous factory.
+func RegisterStatusStore(storageType StorageType, factory StatusStoreFactory) {
+	statusStoresMu.Lock()
+	defer statusStoresMu.Unlock()
+	statusStores[StorageType(strings.ToUpper(string(storageType)))] = factory
+}
+
+// StorageTypes returns the names of all registered status store backends, sorted.
+func StorageTypes() []StorageType {
+	statusStoresMu.RLock()
+	defer statusStoresMu.RUnlock()
+	types := []StorageType{}
+	for t := range statusStores {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// NewStatusStore builds the status store registered for the given storage type.
+func NewStatusStore(storageType StorageType, c Config) (StatusStore, error) {
+	statusStoresMu.RLock()
+	factory, ok := statusStores[StorageType(strings.ToUpper(string(storageType)))]
+	statusStoresMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage type %q, available types are %v", storageType, StorageTypes())
+	}
+	return factory(c)
+}
+
+// newCopyDestination builds the status store a status copy writes to. unlike for a run, a status file that does not
+// exist yet is fine there, it is created.
+func newCopyDestination(storageType StorageType, c Config) (StatusStore, error) {
+	store, err := NewStatusStore(storageType, c)
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := store.(*fileStore); ok {
+		file.allowMissing = true
+	}
+	return store, nil
+}
+
+// newStatusStore picks the status store for this run based on the config.
+// if STORAGE_TYPE is "FILE" and STORAGE_FILE_PATH is set, a local file will be used for storing the publish status.
+// an empty STORAGE_TYPE means github will be used to store the publish status.
+func newStatusStore(c Config) (StatusStore, error) {
+	storageType := c.StorageType
+	if storageType == "" {
+		storageType = Github
+	}
+	if storageType == File && len(c.StorageFile) == 0 {
+		log.Println("STORAGE_TYPE is FILE but STORAGE_FILE_PATH is empty. falling back to github storage")
+		storageType = Github
+	}
+	return NewStatusStore(storageType, c)
+}
+
+// withStatusStore picks the status store for this run, locks it for the duration of fn and releases the lock afterwards.
+func withStatusStore(c Config, fn func(ctx context.Context, store StatusStore) error) error {
+	store, err := newStatusStore(c)
+	if err != nil {
+		return err
+	}
+	defer closeStore(store)
+	return withLock(store, func(ctx context.Context) error {
+		return fn(ctx, store)
+	})
+}
+
+// withLock locks the store for the duration of fn and releases the lock afterwards. the lock of the built in
+// stores is renewed while fn runs, see keepLock. ctx is cancelled if it is lost, fn should then stop posting.
+func withLock(store StatusStore, fn func(ctx context.Context) error) error {
+	release, err := store.Lock()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var renewing <-chan struct{}
+	if backend, ok := store.(lockBackend); ok {
+		renewing = keepLock(ctx, backend, cancel)
+	} else {
+		stopped := make(chan struct{})
+		close(stopped)
+		renewing = stopped
+	}
+	err = fn(ctx)
+	// the renewal is stopped first so it does not race with the release
+	cancel()
+	<-renewing
+	releaseErr := release()
+	if releaseErr != nil {
+		log.Printf("error releasing lock: %v", releaseErr)
+	}
+	return err
+}
+
+func init() {
+	RegisterStatusStore(File, newFileStore)
+	RegisterStatusStore(Github, newGithubStore)
+}
+
+// closeStore closes the store if it implements io.Closer.
+func closeStore(store StatusStore) {
+	closer, ok := store.(io.Closer)
+	if !ok {
+		return
+	}
+	err := closer.Close()
+	if err != nil {
+		log.Printf("error closing status store: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package mediumautopost
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// fileStore keeps the publish status in a json file on the local disk at STORAGE_FILE_PATH.
+// the lock is a file next to it with the same name plus ".lock".
+type fileStore struct {
+	path    string
+	lockTTL time.Duration
+	// allowMissing lets Load start from scratch when the file does not exist, see newCopyDestination.
+	// otherwise a mistyped STORAGE_FILE_PATH would post every article again.
+	allowMissing bool
+}
+
+func newFileStore(c Config) (StatusStore, error) {
+	return &fileStore{path: c.StorageFile, lockTTL: c.LockTTL}, nil
+}
+
+// Load reads the status of already published articles from the local file.
+// the file must exist, unless the store is the destination of a status copy.
+func (s *fileStore) Load() (Status, error) {
+	log.Println("FILE storage type detected. Using local file for status storage")
+	filedata, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) && s.allowMissing {
+		log.Printf("no %s file found. starting from scratch", s.path)
+		return decodeStatus(nil)
+	}
+	if err != nil {
+		return Status{}, err
+	}
+
+	log.Println("unmarshaling status file")
+	return decodeStatus(filedata)
+}
+
+// Save overwrites the local file with the updated status.
+func (s *fileStore) Save(status Status) error {
+	filebytes, err := encodeStatus(status)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, filebytes, 0644)
+}
+
+// Lock creates the lock file, or takes it over if it has expired.
+func (s *fileStore) Lock() (func() error, error) {
+	return acquireLock(s, s.lockTTL)
+}
+
+func (s *fileStore) lockPath() string {
+	return s.path + ".lock"
+}
+
+func (s *fileStore) createLock(info lockInfo) (bool, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(s.lockPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// readLock uses the token in the lock file as its version.
+func (s *fileStore) readLock() (lockInfo, string, bool, error) {
+	data, err := ioutil.ReadFile(s.lockPath())
+	if os.IsNotExist(err) {
+		return lockInfo{}, "", false, nil
+	}
+	if err != nil {
+		return lockInfo{}, "", false, err
+	}
+	info := parseLockInfo(data)
+	return info, info.Token, true, nil
+}
+
+// replaceLock writes the new lock next to the old one and renames it over it, so a run reading the lock while it
+// is renewed never sees a half written file.
+func (s *fileStore) replaceLock(info lockInfo, version string) (bool, error) {
+	current, _, exists, err := s.readLock()
+	if err != nil || !exists || current.Token != version {
+		return false, err
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	tmpPath := s.lockPath() + "." + info.Token
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return false, err
+	}
+	err = os.Rename(tmpPath, s.lockPath())
+	if err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *fileStore) deleteLock(version string) error {
+	err := os.Remove(s.lockPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package mediumautopost
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreMissingFile(t *testing.T) {
+	config := Config{StorageType: File, StorageFile: filepath.Join(t.TempDir(), "status.json")}
+
+	// a run must not start from scratch because of a mistyped STORAGE_FILE_PATH
+	store, err := NewStatusStore(File, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); !os.IsNotExist(err) {
+		t.Fatalf("Load() of a missing file = %v, want a not exist error", err)
+	}
+
+	// but a status copy can create it
+	source := &memoryStore{}
+	err = source.Save(Status{Articles: []PublishedArticle{{ID: "one"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	destination, err := newCopyDestination(File, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = copyStatus(source, destination, func() (StatusStore, error) {
+		return newCopyDestination(File, config)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := store.Load()
+	if err != nil || len(status.Articles) != 1 {
+		t.Fatalf("Load() after the copy = %+v, %v", status, err)
+	}
+}
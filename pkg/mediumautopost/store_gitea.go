@@ -0,0 +1,213 @@
+package mediumautopost
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Gitea is the storage type for keeping the publish status in a gitea (or forgejo) repo.
+const Gitea StorageType = "GITEA"
+
+// giteaLockPath is the file that exists while a run holds the lock.
+const giteaLockPath = "status.json.lock"
+
+// giteaStore keeps the publish status in a status.json file committed to a gitea repo
+// using the repository contents API.
+// the sha of status.json seen by Load is sent with Save, so if another runner committed it
+// in the meantime the save fails with ErrStatusConflict instead of overwriting it. unlike the github
+// store it does not merge and retry, the next run starts from the newer file.
+type giteaStore struct {
+	client  http.Client
+	baseURL string
+	owner   string
+	repo    string
+	branch  string
+	token   string
+	lockTTL time.Duration
+
+	// sha of status.json as of the last Load. empty if the file did not exist.
+	sha string
+}
+
+// giteaContents is the part of the gitea contents response we need. the create and update
+// responses have it as content.
+type giteaContents struct {
+	SHA      string `json:"sha"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+}
+
+func newGiteaStore(c Config) (StatusStore, error) {
+	if c.GiteaBaseURL == "" || c.GiteaRepoOwner == "" || c.GiteaRepo == "" {
+		return nil, errors.New("STORAGE_TYPE is GITEA but GITEA_BASE_URL, GITEA_REPO_OWNER or GITEA_REPO is empty")
+	}
+	branch := c.GiteaBranch
+	if branch == "" {
+		branch = "main"
+	}
+	return &giteaStore{
+		client:  http.Client{Timeout: 30 * time.Second},
+		baseURL: strings.TrimSuffix(c.GiteaBaseURL, "/"),
+		owner:   c.GiteaRepoOwner,
+		repo:    c.GiteaRepo,
+		branch:  branch,
+		token:   c.GiteaToken,
+		lockTTL: c.LockTTL,
+	}, nil
+}
+
+func (s *giteaStore) contentsURL(path string) string {
+	return s.baseURL + "/api/v1/repos/" + url.PathEscape(s.owner) + "/" + url.PathEscape(s.repo) + "/contents/" + path
+}
+
+func (s *giteaStore) headers() map[string]string {
+	if s.token == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "token " + s.token}
+}
+
+// getFile fetches a file from the branch. it returns nil if the file does not exist yet.
+func (s *giteaStore) getFile(path string) (*giteaContents, error) {
+	contents := giteaContents{}
+	err := doJSON(s.client, http.MethodGet, s.contentsURL(path)+"?ref="+url.QueryEscape(s.branch), s.headers(), nil, &contents)
+	if isStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &contents, nil
+}
+
+// Load downloads status.json from the branch of the status repo (GITEA_BRANCH, default main).
+// if the file does not exist yet an empty list is returned so the run starts from scratch.
+func (s *giteaStore) Load() (Status, error) {
+	status, _ := decodeStatus(nil)
+	log.Println("Pulling list of already published articles from gitea")
+	file, err := s.getFile("status.json")
+	if err != nil {
+		return status, err
+	}
+	if file == nil {
+		log.Println("no status.json file found. starting from scratch")
+		s.sha = ""
+		return status, nil
+	}
+	s.sha = file.SHA
+	filedata := []byte(file.Content)
+	if file.Encoding == "base64" {
+		filedata, err = base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	log.Println("unmarshaling status.json")
+	return decodeStatus(filedata)
+}
+
+// Save commits status.json to the branch, but only if it has not changed since Load. gitea updates a file
+// only with the sha of its current version, and creates it only if it does not exist.
+func (s *giteaStore) Save(status Status) error {
+	filebytes, err := encodeStatus(status)
+	if err != nil {
+		return err
+	}
+
+	log.Println("creating commit")
+	options := map[string]string{
+		"branch":  s.branch,
+		"message": "update the medium content",
+		"content": base64.StdEncoding.EncodeToString(filebytes),
+	}
+	method := http.MethodPost
+	if s.sha != "" {
+		method = http.MethodPut
+		options["sha"] = s.sha
+	}
+	written := struct {
+		Content giteaContents `json:"content"`
+	}{}
+	err = doJSON(s.client, method, s.contentsURL("status.json"), s.headers(), options, &written)
+	if isStatus(err, http.StatusConflict, http.StatusUnprocessableEntity) {
+		return fmt.Errorf("gitea commit status.json: %w: %v", ErrStatusConflict, err)
+	}
+	if err != nil {
+		return err
+	}
+	s.sha = written.Content.SHA
+	return nil
+}
+
+// Lock commits a status.json.lock file next to the status file. gitea refuses to create a file that exists
+// or to update one with a stale sha, so only one run can take the lock.
+func (s *giteaStore) Lock() (func() error, error) {
+	return acquireLock(s, s.lockTTL)
+}
+
+func (s *giteaStore) writeLock(info lockInfo, sha string) (bool, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	options := map[string]string{
+		"branch":  s.branch,
+		"message": "lock medium publishing",
+		"content": base64.StdEncoding.EncodeToString(data),
+	}
+	method := http.MethodPost
+	if sha != "" {
+		method = http.MethodPut
+		options["sha"] = sha
+	}
+	err = doJSON(s.client, method, s.contentsURL(giteaLockPath), s.headers(), options, nil)
+	if isStatus(err, http.StatusConflict, http.StatusUnprocessableEntity) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *giteaStore) createLock(info lockInfo) (bool, error) {
+	return s.writeLock(info, "")
+}
+
+// readLock uses the sha of the lock file as its version.
+func (s *giteaStore) readLock() (lockInfo, string, bool, error) {
+	file, err := s.getFile(giteaLockPath)
+	if err != nil || file == nil {
+		return lockInfo{}, "", false, err
+	}
+	data, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		data = []byte(file.Content)
+	}
+	return parseLockInfo(data), file.SHA, true, nil
+}
+
+func (s *giteaStore) replaceLock(info lockInfo, version string) (bool, error) {
+	return s.writeLock(info, version)
+}
+
+func (s *giteaStore) deleteLock(version string) error {
+	err := doJSON(s.client, http.MethodDelete, s.contentsURL(giteaLockPath), s.headers(), map[string]string{
+		"branch":  s.branch,
+		"message": "unlock medium publishing",
+		"sha":     version,
+	}, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+func init() {
+	RegisterStatusStore(Gitea, newGiteaStore)
+}
@@ -0,0 +1,128 @@
+package mediumautopost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testGitea is a stand-in for the repository contents API of a gitea repo. like gitea it refuses to create
+// a file that exists or to update one with a sha that is not the current one.
+type testGitea struct {
+	mu      sync.Mutex
+	files   map[string]giteaContents // branch + ":" + path
+	version int
+}
+
+func (g *testGitea) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	path := r.URL.Path[strings.Index(r.URL.Path, "/contents/")+len("/contents/"):]
+	if r.Method == http.MethodGet {
+		file, exists := g.files[r.URL.Query().Get("ref")+":"+path]
+		if !exists {
+			http.Error(w, `{"message":"GetContentsOrList"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(file)
+		return
+	}
+	options := map[string]string{}
+	json.NewDecoder(r.Body).Decode(&options)
+	key := options["branch"] + ":" + path
+	file, exists := g.files[key]
+	switch {
+	case r.Method == http.MethodPost && exists:
+		http.Error(w, `{"message":"repository file already exists"}`, http.StatusUnprocessableEntity)
+		return
+	case r.Method != http.MethodPost && (!exists || options["sha"] != file.SHA):
+		http.Error(w, `{"message":"sha does not match"}`, http.StatusConflict)
+		return
+	case r.Method == http.MethodDelete:
+		delete(g.files, key)
+		return
+	}
+	g.version++
+	file = giteaContents{SHA: fmt.Sprintf("sha%d", g.version), Encoding: "base64", Content: options["content"]}
+	g.files[key] = file
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]giteaContents{"content": file})
+}
+
+func TestGiteaStoreConflict(t *testing.T) {
+	gitea := &testGitea{files: map[string]giteaContents{}}
+	server := httptest.NewServer(gitea)
+	defer server.Close()
+	config := Config{GiteaBaseURL: server.URL, GiteaRepoOwner: "owner", GiteaRepo: "repo", GiteaBranch: "status"}
+	first, err := newGiteaStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newGiteaStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both runners start from scratch, only the first one can create the file
+	if _, err := first.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Load(); err != nil {
+		t.Fatal(err)
+	}
+	err = first.Save(Status{Articles: []PublishedArticle{{ID: "one"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := gitea.files["status:status.json"]; !exists {
+		t.Fatalf("status.json was not committed to GITEA_BRANCH, files: %v", gitea.files)
+	}
+	err = second.Save(Status{Articles: []PublishedArticle{{ID: "two"}}})
+	if !errors.Is(err, ErrStatusConflict) {
+		t.Fatalf("Save() over a newer file = %v, want ErrStatusConflict", err)
+	}
+
+	// the first runner can save again on top of its own commit
+	err = first.Save(Status{Articles: []PublishedArticle{{ID: "one"}, {ID: "three"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after loading the new version the second runner can save, and the first one now conflicts
+	status, err := second.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Articles) != 2 {
+		t.Fatalf("Load() = %+v, want the first runner's status", status)
+	}
+	err = second.Save(Status{Articles: append(status.Articles, PublishedArticle{ID: "two"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = first.Save(Status{Articles: []PublishedArticle{{ID: "one"}, {ID: "four"}}})
+	if !errors.Is(err, ErrStatusConflict) {
+		t.Fatalf("Save() with a stale sha = %v, want ErrStatusConflict", err)
+	}
+
+	// the lock lives on the same branch
+	release, err := first.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Lock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock() = %v, want ErrLocked", err)
+	}
+	err = release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := gitea.files["status:status.json.lock"]; exists {
+		t.Fatal("the lock was not released")
+	}
+}
@@ -0,0 +1,393 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultCommitMessage is used when GITHUB_COMMIT_MESSAGE is empty.
+	defaultCommitMessage = "update the medium content"
+	// githubSaveAttempts is how many times Save tries to commit when the branch keeps moving.
+	githubSaveAttempts = 5
+	// githubLockBranch is the branch that exists while a run holds the lock.
+	githubLockBranch = "mediumautopost-lock"
+)
+
+// githubStore keeps the publish status in a json file committed to a github repo.
+// the branch, file path, commit message and committer come from the config.
+type githubStore struct {
+	client         *github.Client
+	owner          string
+	repo           string
+	branch         string
+	path           string
+	message        *template.Template
+	committerName  string
+	committerEmail string
+
+	// ids of the articles as of the last Load, used to tell which articles are new in Save
+	loaded map[string]bool
+	// the branch head the status was last read from or written to
+	loadedHead string
+	lockTTL    time.Duration
+	// retryDelay is the wait before the first retry of a commit whose ref update was rejected
+	retryDelay time.Duration
+}
+
+// errBranchMoved is returned by commit when github rejects the ref update because the branch moved.
+var errBranchMoved = errors.New("the branch moved while committing")
+
+// commitMessageData is what the GITHUB_COMMIT_MESSAGE template is executed with.
+// the template can also use the join function, e.g. {{join .Titles ", "}}
+type commitMessageData struct {
+	// Count is the number of articles posted during this run
+	Count int
+	// Titles are the titles of the articles posted during this run
+	Titles []string
+	// Total is the number of articles in the status file
+	Total int
+}
+
+func newGithubStore(c Config) (StatusStore, error) {
+	if (c.GithubCommitterName == "") != (c.GithubCommitterEmail == "") {
+		return nil, errors.New("GITHUB_COMMITTER_NAME and GITHUB_COMMITTER_EMAIL must be set together")
+	}
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: c.GithubPersonalToken},
+	)
+	tc := oauth2.NewClient(ctx, ts)
+
+	messageTemplate := c.GithubCommitMessage
+	if messageTemplate == "" {
+		messageTemplate = defaultCommitMessage
+	}
+	message, err := template.New("commit").Funcs(template.FuncMap{"join": strings.Join}).Parse(messageTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_COMMIT_MESSAGE: %v", err)
+	}
+	branch := c.GithubStatusBranch
+	if branch == "" {
+		branch = "main"
+	}
+	path := strings.TrimPrefix(c.GithubStatusPath, "/")
+	if path == "" {
+		path = "status.json"
+	}
+
+	return &githubStore{
+		client:         github.NewClient(tc),
+		owner:          c.GithubStatusRepoOwner,
+		repo:           c.GithubStatusRepo,
+		branch:         branch,
+		path:           path,
+		message:        message,
+		committerName:  c.GithubCommitterName,
+		committerEmail: c.GithubCommitterEmail,
+		loaded:         map[string]bool{},
+		lockTTL:        c.LockTTL,
+		retryDelay:     time.Second,
+	}, nil
+}
+
+// commitMessage renders the commit message template for the articles that are new since Load.
+func (s *githubStore) commitMessage(publishedArticles []PublishedArticle) (string, error) {
+	data := commitMessageData{Titles: []string{}, Total: len(publishedArticles)}
+	for _, article := range publishedArticles {
+		if !s.loaded[article.ID] {
+			data.Count++
+			data.Titles = append(data.Titles, article.Platforms[Medium].Title)
+		}
+	}
+	var b bytes.Buffer
+	err := s.message.Execute(&b, data)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// committer returns the identity to commit as, or nil to let github use the token's user. the name and email are
+// set together, see newGithubStore.
+func (s *githubStore) committer() *github.CommitAuthor {
+	if s.committerName == "" {
+		return nil
+	}
+	now := time.Now()
+	return &github.CommitAuthor{
+		Name:  &s.committerName,
+		Email: &s.committerEmail,
+		Date:  &now,
+	}
+}
+
+// Load downloads the status file from the configured branch of the status repo.
+// if the file (or its directory) does not exist yet an empty list is returned so the run starts from scratch.
+// the commit it was read from is remembered so Save can tell if someone else committed in the meantime.
+func (s *githubStore) Load() (Status, error) {
+	ctx := context.Background()
+	log.Printf("Pulling list of already published articles from %s on branch %s", s.path, s.branch)
+	branch, _, err := s.client.Repositories.GetBranch(ctx, s.owner, s.repo, s.branch)
+	if err != nil {
+		return Status{}, err
+	}
+	s.loadedHead = branch.Commit.GetSHA()
+
+	status, err := s.download(ctx, s.loadedHead)
+	if err != nil {
+		return status, err
+	}
+	for _, article := range status.Articles {
+		s.loaded[article.ID] = true
+	}
+	return status, nil
+}
+
+// download reads the status file as of the given commit or branch.
+func (s *githubStore) download(ctx context.Context, ref string) (Status, error) {
+	status, _ := decodeStatus(nil)
+	gitoptions := github.RepositoryContentGetOptions{
+		Ref: ref,
+	}
+	rc, err := s.client.Repositories.DownloadContents(ctx, s.owner, s.repo, s.path, &gitoptions)
+	if err != nil && (strings.Contains(err.Error(), "No file named") || isGithubStatus(err, http.StatusNotFound)) {
+		log.Printf("no %s file found. starting from scratch", s.path)
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	defer rc.Close()
+	filedata, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return status, err
+	}
+
+	log.Printf("unmarshaling %s", s.path)
+	return decodeStatus(filedata)
+}
+
+// Save commits the updated status back to github so its up to date for the next time this runs.
+// if the branch moved since Load, or moves while committing (github rejects the ref update as not a fast forward),
+// the remote status file is read again, merged with ours by article ID and the commit is retried with backoff.
+// this way articles that were already posted to medium are never dropped from the status.
+func (s *githubStore) Save(status Status) error {
+	ctx := context.Background()
+	message, err := s.commitMessage(status.Articles)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = s.commit(ctx, status, message)
+		if err == nil || !errors.Is(err, errBranchMoved) {
+			return err
+		}
+		if attempt == githubSaveAttempts {
+			return fmt.Errorf("%w: giving up after %v attempts: %v", ErrStatusConflict, attempt, err)
+		}
+		wait := backoff(attempt, s.retryDelay)
+		log.Printf("%s was updated by someone else, retrying in %v", s.branch, wait)
+		time.Sleep(wait)
+	}
+}
+
+// commit creates one commit with the status file on top of the current branch head and moves the branch to it.
+// I'm not gonna lie, this is a bit complicated. the process is outlined here: http://www.levibotelho.com/development/commit-a-file-with-the-github-api/
+// This code does those steps using go-github.
+func (s *githubStore) commit(ctx context.Context, status Status, message string) error {
+	log.Printf("fetching %s branch", s.branch)
+	branch, _, err := s.client.Repositories.GetBranch(ctx, s.owner, s.repo, s.branch)
+	if err != nil {
+		return err
+	}
+
+	if branch.Commit.GetSHA() != s.loadedHead {
+		log.Printf("%s changed since it was loaded, merging with the remote status", s.branch)
+		remote, err := s.download(ctx, branch.Commit.GetSHA())
+		if err != nil {
+			return err
+		}
+		status = mergeStatus(remote, status)
+	}
+
+	filebytes, err := encodeStatus(status)
+	if err != nil {
+		return err
+	}
+	filebytesSting := string(filebytes)
+
+	log.Println("creating blob")
+	blob, _, err := s.client.Git.CreateBlob(ctx, s.owner, s.repo, &github.Blob{
+		Content: &filebytesSting,
+	})
+	if err != nil {
+		return err
+	}
+
+	path := s.path
+	mode := "100644"
+	treetype := "blob"
+
+	log.Println("creating tree")
+	tree, _, err := s.client.Git.CreateTree(ctx, s.owner, s.repo, *branch.Commit.Commit.Tree.SHA, []github.TreeEntry{
+		{
+			Path: &path,
+			Mode: &mode,
+			Type: &treetype,
+			SHA:  blob.SHA,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("creating commit")
+	newCommit, _, err := s.client.Git.CreateCommit(ctx, s.owner, s.repo, &github.Commit{
+		Parents: []github.Commit{
+			{
+				SHA: branch.Commit.SHA,
+			},
+		},
+		Tree:      tree,
+		Message:   &message,
+		Author:    s.committer(),
+		Committer: s.committer(),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("updating ref")
+	branchref := "refs/heads/" + s.branch
+	reference := github.Reference{
+		Object: &github.GitObject{
+			SHA: newCommit.SHA,
+		},
+		Ref: &branchref,
+	}
+	_, _, err = s.client.Git.UpdateRef(ctx, s.owner, s.repo, &reference, false)
+	// github answers 422 when the update is not a fast forward. the 422s of the other calls are permanent errors,
+	// e.g. an invalid committer, and are not retried
+	if isGithubStatus(err, http.StatusUnprocessableEntity) {
+		return fmt.Errorf("%w: %v", errBranchMoved, err)
+	}
+	if err != nil {
+		return err
+	}
+	s.loadedHead = newCommit.GetSHA()
+	for _, article := range status.Articles {
+		s.loaded[article.ID] = true
+	}
+	return nil
+}
+
+// Lock creates the githubLockBranch branch pointing at a commit whose message describes the lock holder.
+// creating a branch that already exists fails, and a stale lock is taken over with a fast forward
+// on top of the stale lock commit, so only one run can win either way.
+func (s *githubStore) Lock() (func() error, error) {
+	return acquireLock(s, s.lockTTL)
+}
+
+// lockCommit creates a commit holding the lock info in its message. it reuses the tree of the status branch.
+func (s *githubStore) lockCommit(ctx context.Context, info lockInfo, parent string) (*github.Commit, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	message := string(data)
+	branch, _, err := s.client.Repositories.GetBranch(ctx, s.owner, s.repo, s.branch)
+	if err != nil {
+		return nil, err
+	}
+	commit := &github.Commit{
+		Message:   &message,
+		Tree:      &github.Tree{SHA: branch.Commit.Commit.Tree.SHA},
+		Author:    s.committer(),
+		Committer: s.committer(),
+	}
+	if parent != "" {
+		commit.Parents = []github.Commit{{SHA: &parent}}
+	}
+	newCommit, _, err := s.client.Git.CreateCommit(ctx, s.owner, s.repo, commit)
+	return newCommit, err
+}
+
+func (s *githubStore) createLock(info lockInfo) (bool, error) {
+	ctx := context.Background()
+	commit, err := s.lockCommit(ctx, info, "")
+	if err != nil {
+		return false, err
+	}
+	ref := "refs/heads/" + githubLockBranch
+	_, _, err = s.client.Git.CreateRef(ctx, s.owner, s.repo, &github.Reference{
+		Ref:    &ref,
+		Object: &github.GitObject{SHA: commit.SHA},
+	})
+	if isGithubStatus(err, http.StatusUnprocessableEntity) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// readLock uses the sha of the lock commit as its version.
+func (s *githubStore) readLock() (lockInfo, string, bool, error) {
+	ctx := context.Background()
+	ref, _, err := s.client.Git.GetRef(ctx, s.owner, s.repo, "heads/"+githubLockBranch)
+	if isGithubStatus(err, http.StatusNotFound) {
+		return lockInfo{}, "", false, nil
+	}
+	if err != nil {
+		return lockInfo{}, "", false, err
+	}
+	sha := ref.Object.GetSHA()
+	commit, _, err := s.client.Git.GetCommit(ctx, s.owner, s.repo, sha)
+	if err != nil {
+		return lockInfo{}, "", false, err
+	}
+	return parseLockInfo([]byte(commit.GetMessage())), sha, true, nil
+}
+
+func (s *githubStore) replaceLock(info lockInfo, version string) (bool, error) {
+	ctx := context.Background()
+	commit, err := s.lockCommit(ctx, info, version)
+	if err != nil {
+		return false, err
+	}
+	ref := "refs/heads/" + githubLockBranch
+	_, _, err = s.client.Git.UpdateRef(ctx, s.owner, s.repo, &github.Reference{
+		Ref:    &ref,
+		Object: &github.GitObject{SHA: commit.SHA},
+	}, false)
+	if isGithubStatus(err, http.StatusUnprocessableEntity) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *githubStore) deleteLock(version string) error {
+	_, err := s.client.Git.DeleteRef(context.Background(), s.owner, s.repo, "heads/"+githubLockBranch)
+	if isGithubStatus(err, http.StatusNotFound) || isGithubStatus(err, http.StatusUnprocessableEntity) {
+		return nil
+	}
+	return err
+}
+
+// isGithubStatus reports whether err is an error response from the github API with the given status code.
+func isGithubStatus(err error, code int) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == code
+}
@@ -0,0 +1,333 @@
+package mediumautopost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// testGithub is a stand-in for the parts of the github API the status store uses. it keeps one branch, main, whose
+// commits only hold the status file. like github it refuses a ref update that is not a fast forward with a 422.
+type testGithub struct {
+	*httptest.Server
+	mu      sync.Mutex
+	head    string
+	commits map[string]testGithubCommit
+	blobs   map[string]string
+	trees   map[string]string // tree sha to the content of the status file, empty if it has none
+	version int
+	// beforeUpdateRef and createCommit let a test change what the next request sees or gets
+	beforeUpdateRef func()
+	createCommit    func(w http.ResponseWriter) bool
+}
+
+type testGithubCommit struct {
+	Tree      string
+	Parent    string
+	Message   string
+	Committer *github.CommitAuthor
+}
+
+func newTestGithub(t *testing.T) *testGithub {
+	t.Helper()
+	g := &testGithub{commits: map[string]testGithubCommit{}, blobs: map[string]string{}, trees: map[string]string{"tree0": ""}}
+	g.head = "commit0"
+	g.commits["commit0"] = testGithubCommit{Tree: "tree0"}
+	g.Server = httptest.NewServer(http.HandlerFunc(g.serve))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *testGithub) nextSHA(kind string) string {
+	g.version++
+	return fmt.Sprint(kind, g.version)
+}
+
+// push commits a status file to main directly, like another runner would.
+func (g *testGithub) push(content string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tree := g.nextSHA("tree")
+	g.trees[tree] = content
+	commit := g.nextSHA("commit")
+	g.commits[commit] = testGithubCommit{Tree: tree, Parent: g.head}
+	g.head = commit
+}
+
+// status returns the status file at the head of main.
+func (g *testGithub) status(t *testing.T) Status {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	status, err := decodeStatus([]byte(g.trees[g.commits[g.head].Tree]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func (g *testGithub) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch && g.beforeUpdateRef != nil {
+		before := g.beforeUpdateRef
+		g.beforeUpdateRef = nil
+		before()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/repos/owner/repo")
+	switch {
+	case r.Method == http.MethodGet && path == "/branches/main":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":   "main",
+			"commit": map[string]interface{}{"sha": g.head, "commit": map[string]interface{}{"tree": map[string]string{"sha": g.commits[g.head].Tree}}},
+		})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/contents"):
+		commit := g.commits[r.URL.Query().Get("ref")]
+		entries := []map[string]string{}
+		if g.trees[commit.Tree] != "" {
+			entries = append(entries, map[string]string{"name": "status.json", "type": "file", "download_url": g.URL + "/raw/" + commit.Tree})
+		}
+		json.NewEncoder(w).Encode(entries)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/raw/"):
+		fmt.Fprint(w, g.trees[strings.TrimPrefix(r.URL.Path, "/raw/")])
+	case r.Method == http.MethodPost && path == "/git/blobs":
+		blob := github.Blob{}
+		json.NewDecoder(r.Body).Decode(&blob)
+		sha := g.nextSHA("blob")
+		g.blobs[sha] = blob.GetContent()
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"sha":%q}`, sha)
+	case r.Method == http.MethodPost && path == "/git/trees":
+		tree := struct {
+			Tree []github.TreeEntry `json:"tree"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&tree)
+		sha := g.nextSHA("tree")
+		g.trees[sha] = g.blobs[tree.Tree[0].GetSHA()]
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"sha":%q}`, sha)
+	case r.Method == http.MethodPost && path == "/git/commits":
+		if g.createCommit != nil && g.createCommit(w) {
+			return
+		}
+		commit := struct {
+			Message   string               `json:"message"`
+			Tree      string               `json:"tree"`
+			Parents   []string             `json:"parents"`
+			Committer *github.CommitAuthor `json:"committer"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&commit)
+		sha := g.nextSHA("commit")
+		g.commits[sha] = testGithubCommit{Tree: commit.Tree, Parent: commit.Parents[0], Message: commit.Message, Committer: commit.Committer}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"sha":%q}`, sha)
+	case r.Method == http.MethodPatch && path == "/git/refs/heads/main":
+		update := struct {
+			SHA string `json:"sha"`
+		}{}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &update)
+		if g.commits[update.SHA].Parent != g.head {
+			http.Error(w, `{"message":"Update is not a fast forward"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		g.head = update.SHA
+		fmt.Fprintf(w, `{"ref":"refs/heads/main","object":{"sha":%q}}`, update.SHA)
+	default:
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}
+}
+
+func testGithubStore(t *testing.T, g *testGithub, c Config) *githubStore {
+	t.Helper()
+	c.GithubStatusRepoOwner = "owner"
+	c.GithubStatusRepo = "repo"
+	store, err := newGithubStore(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.(*githubStore)
+	s.client.BaseURL, _ = url.Parse(g.URL + "/")
+	s.retryDelay = time.Millisecond
+	return s
+}
+
+func encodedStatus(t *testing.T, ids ...string) string {
+	t.Helper()
+	status := Status{}
+	for _, id := range ids {
+		status.Articles = append(status.Articles, PublishedArticle{ID: id})
+	}
+	data, err := encodeStatus(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func statusIDs(status Status) string {
+	ids := []string{}
+	for _, article := range status.Articles {
+		ids = append(ids, article.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestGithubStoreMergesWhenTheBranchMoved(t *testing.T) {
+	g := newTestGithub(t)
+	g.push(encodedStatus(t, "one"))
+	store := testGithubStore(t, g, Config{})
+
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another runner commits between our Load and Save
+	g.push(encodedStatus(t, "one", "two"))
+	status.Articles = append(status.Articles, PublishedArticle{ID: "three"})
+	err = store.Save(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statusIDs(g.status(t)); got != "one,two,three" {
+		t.Fatalf("saved status has %s, want one,two,three", got)
+	}
+
+	// and while we are committing: the ref update is rejected, the commit is merged and retried
+	g.beforeUpdateRef = func() { g.push(encodedStatus(t, "one", "two", "three", "four")) }
+	status.Articles = append(status.Articles, PublishedArticle{ID: "five"})
+	err = store.Save(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statusIDs(g.status(t)); got != "one,two,three,four,five" {
+		t.Fatalf("saved status has %s, want one,two,three,four,five", got)
+	}
+}
+
+func TestGithubStoreGivesUpWhenTheBranchKeepsMoving(t *testing.T) {
+	g := newTestGithub(t)
+	store := testGithubStore(t, g, Config{})
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moves func()
+	moves = func() {
+		g.push(encodedStatus(t, "other"))
+		g.beforeUpdateRef = moves
+	}
+	g.beforeUpdateRef = moves
+	err = store.Save(status)
+	if !errors.Is(err, ErrStatusConflict) {
+		t.Fatalf("Save() = %v, want ErrStatusConflict", err)
+	}
+}
+
+func TestGithubStoreDoesNotRetryPermanentErrors(t *testing.T) {
+	g := newTestGithub(t)
+	store := testGithubStore(t, g, Config{})
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := 0
+	g.createCommit = func(w http.ResponseWriter) bool {
+		attempts++
+		http.Error(w, `{"message":"Invalid request.\n\n\"email\" is not a valid email"}`, http.StatusUnprocessableEntity)
+		return true
+	}
+	err = store.Save(status)
+	if err == nil || errors.Is(err, ErrStatusConflict) || attempts != 1 {
+		t.Fatalf("Save() = %v after %v attempts, want the error of the first attempt", err, attempts)
+	}
+}
+
+func TestGithubStoreCommitMessage(t *testing.T) {
+	posted := func(id, title string) PublishedArticle {
+		return PublishedArticle{ID: id, Platforms: map[string]PlatformResult{Medium: {Title: title}}}
+	}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default", "", defaultCommitMessage},
+		{"count and total", "post {{.Count}} of {{.Total}} articles", "post 2 of 3 articles"},
+		{"titles", `add {{join .Titles ", "}}`, "add Two, Three"},
+		{"range", "{{range .Titles}}[{{.}}]{{end}}", "[Two][Three]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newTestGithub(t)
+			g.push(encodedStatus(t, "one"))
+			store := testGithubStore(t, g, Config{GithubCommitMessage: test.template})
+			status, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			status.Articles = []PublishedArticle{posted("one", "One"), posted("two", "Two"), posted("three", "Three")}
+			err = store.Save(status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := g.commits[g.head].Message; got != test.want {
+				t.Fatalf("commit message = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGithubStoreInvalidCommitMessage(t *testing.T) {
+	_, err := newGithubStore(Config{GithubCommitMessage: "{{.Count"})
+	if err == nil || !strings.Contains(err.Error(), "GITHUB_COMMIT_MESSAGE") {
+		t.Fatalf("newGithubStore() = %v, want an error for the template", err)
+	}
+}
+
+func TestGithubStoreCommitter(t *testing.T) {
+	for _, c := range []Config{{GithubCommitterName: "bot"}, {GithubCommitterEmail: "bot@example.com"}} {
+		_, err := newGithubStore(c)
+		if err == nil {
+			t.Fatalf("newGithubStore(%+v) = nil, want an error when only one of the committer settings is set", c)
+		}
+	}
+
+	g := newTestGithub(t)
+	store := testGithubStore(t, g, Config{})
+	status, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Save(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committer := g.commits[g.head].Committer; committer != nil {
+		t.Fatalf("committer = %+v, want none without the settings", committer)
+	}
+
+	store = testGithubStore(t, g, Config{GithubCommitterName: "bot", GithubCommitterEmail: "bot@example.com"})
+	status, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Save(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committer := g.commits[g.head].Committer
+	if committer.GetName() != "bot" || committer.GetEmail() != "bot@example.com" {
+		t.Fatalf("committer = %+v, want bot <bot@example.com>", committer)
+	}
+}
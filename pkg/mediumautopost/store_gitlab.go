@@ -0,0 +1,243 @@
+package mediumautopost
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Gitlab is the storage type for keeping the publish status in a gitlab repo (gitlab.com or self hosted).
+const Gitlab StorageType = "GITLAB"
+
+// gitlabLockPath is the file that exists while a run holds the lock.
+const gitlabLockPath = "status.json.lock"
+
+// gitlabStore keeps the publish status in a status.json file committed to a gitlab project
+// using the repository files and commits APIs.
+// the last commit of status.json seen by Load is sent with Save as last_commit_id, so if another runner
+// committed it in the meantime the save fails with ErrStatusConflict instead of overwriting it. unlike the github
+// store it does not merge and retry, the next run starts from the newer file.
+type gitlabStore struct {
+	client  http.Client
+	baseURL string
+	project string
+	branch  string
+	token   string
+	lockTTL time.Duration
+
+	// last commit of status.json as of the last Load. empty if the file did not exist.
+	lastCommitID string
+}
+
+// the messages gitlab answers a commit with, with 400 Bad Request, when a file action does not match the branch.
+// other 400s, e.g. for a branch that does not exist, are real errors.
+var gitlabFileChangedMessages = []string{
+	"has changed since you started editing it",
+	"A file with this name already exists",
+	"A file with this name doesn't exist",
+}
+
+// gitlabFile is the part of the gitlab repository file response we need.
+type gitlabFile struct {
+	Encoding     string `json:"encoding"`
+	Content      string `json:"content"`
+	LastCommitID string `json:"last_commit_id"`
+}
+
+func newGitlabStore(c Config) (StatusStore, error) {
+	if c.GitlabProject == "" {
+		return nil, errors.New("STORAGE_TYPE is GITLAB but GITLAB_PROJECT is empty")
+	}
+	baseURL := c.GitlabBaseURL
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	branch := c.GitlabBranch
+	if branch == "" {
+		branch = "main"
+	}
+	return &gitlabStore{
+		client:  http.Client{Timeout: 30 * time.Second},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		project: c.GitlabProject,
+		branch:  branch,
+		token:   c.GitlabToken,
+		lockTTL: c.LockTTL,
+	}, nil
+}
+
+// projectURL builds an API url for the project. the project can be a numeric id or a "group/project" path.
+func (s *gitlabStore) projectURL(format string, a ...interface{}) string {
+	return s.baseURL + "/api/v4/projects/" + url.PathEscape(s.project) + fmt.Sprintf(format, a...)
+}
+
+func (s *gitlabStore) headers() map[string]string {
+	return map[string]string{"PRIVATE-TOKEN": s.token}
+}
+
+// getFile fetches a file from the branch. it returns nil if the file does not exist yet.
+func (s *gitlabStore) getFile(path string) (*gitlabFile, error) {
+	file := gitlabFile{}
+	err := doJSON(s.client, http.MethodGet, s.projectURL("/repository/files/%s?ref=%s", url.PathEscape(path), url.QueryEscape(s.branch)), s.headers(), nil, &file)
+	if isStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Load downloads status.json from the branch of the status project (GITLAB_BRANCH, default main).
+// if the file does not exist yet an empty list is returned so the run starts from scratch.
+func (s *gitlabStore) Load() (Status, error) {
+	status, _ := decodeStatus(nil)
+	log.Println("Pulling list of already published articles from gitlab")
+	file, err := s.getFile("status.json")
+	if err != nil {
+		return status, err
+	}
+	if file == nil {
+		log.Println("no status.json file found. starting from scratch")
+		s.lastCommitID = ""
+		return status, nil
+	}
+	s.lastCommitID = file.LastCommitID
+	filedata := []byte(file.Content)
+	if file.Encoding == "base64" {
+		filedata, err = base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	log.Println("unmarshaling status.json")
+	return decodeStatus(filedata)
+}
+
+// Save commits status.json to the branch, but only if it has not changed since Load. the file is created
+// if Load did not find it, gitlab then refuses the commit if someone else created it in the meantime.
+func (s *gitlabStore) Save(status Status) error {
+	filebytes, err := encodeStatus(status)
+	if err != nil {
+		return err
+	}
+	fileAction := map[string]string{
+		"action":    "create",
+		"file_path": "status.json",
+		"content":   string(filebytes),
+	}
+	if s.lastCommitID != "" {
+		fileAction["action"] = "update"
+		fileAction["last_commit_id"] = s.lastCommitID
+	}
+
+	log.Println("creating commit")
+	commitID, err := s.commit("update the medium content", fileAction)
+	if isGitlabFileChanged(err) {
+		return fmt.Errorf("gitlab commit status.json: %w: %v", ErrStatusConflict, err)
+	}
+	if err != nil {
+		return err
+	}
+	s.lastCommitID = commitID
+	return nil
+}
+
+// commit commits a single file action (create, update or delete) to the branch and returns the id of the commit.
+func (s *gitlabStore) commit(message string, action map[string]string) (string, error) {
+	commit := map[string]interface{}{
+		"branch":         s.branch,
+		"commit_message": message,
+		"actions":        []map[string]string{action},
+	}
+	created := struct {
+		ID string `json:"id"`
+	}{}
+	err := doJSON(s.client, http.MethodPost, s.projectURL("/repository/commits"), s.headers(), commit, &created)
+	return created.ID, err
+}
+
+// Lock commits a status.json.lock file next to the status file. gitlab refuses to create a file that exists
+// or to update one whose last commit is not the one we read, so only one run can take the lock.
+func (s *gitlabStore) Lock() (func() error, error) {
+	return acquireLock(s, s.lockTTL)
+}
+
+func (s *gitlabStore) writeLock(info lockInfo, action, lastCommitID string) (bool, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	fileAction := map[string]string{
+		"action":    action,
+		"file_path": gitlabLockPath,
+		"content":   string(data),
+	}
+	if lastCommitID != "" {
+		fileAction["last_commit_id"] = lastCommitID
+	}
+	_, err = s.commit("lock medium publishing", fileAction)
+	if isGitlabFileChanged(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *gitlabStore) createLock(info lockInfo) (bool, error) {
+	return s.writeLock(info, "create", "")
+}
+
+// readLock uses the last commit that touched the lock file as its version.
+func (s *gitlabStore) readLock() (lockInfo, string, bool, error) {
+	file, err := s.getFile(gitlabLockPath)
+	if err != nil || file == nil {
+		return lockInfo{}, "", false, err
+	}
+	data, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		data = []byte(file.Content)
+	}
+	return parseLockInfo(data), file.LastCommitID, true, nil
+}
+
+func (s *gitlabStore) replaceLock(info lockInfo, version string) (bool, error) {
+	return s.writeLock(info, "update", version)
+}
+
+func (s *gitlabStore) deleteLock(version string) error {
+	_, err := s.commit("unlock medium publishing", map[string]string{
+		"action":         "delete",
+		"file_path":      gitlabLockPath,
+		"last_commit_id": version,
+	})
+	if isGitlabFileChanged(err) {
+		return nil
+	}
+	return err
+}
+
+// isGitlabFileChanged reports whether a commit was refused because a file was created, changed or deleted by
+// someone else.
+func isGitlabFileChanged(err error) bool {
+	var apiErr *apiError
+	if !isStatus(err, http.StatusBadRequest) || !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, message := range gitlabFileChangedMessages {
+		if strings.Contains(apiErr.Body, message) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterStatusStore(Gitlab, newGitlabStore)
+}
@@ -0,0 +1,183 @@
+package mediumautopost
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testGitlab is a stand-in for the repository files and commits APIs of a gitlab project. like gitlab it refuses
+// to create a file that exists or to update one whose last commit is not last_commit_id.
+type testGitlab struct {
+	mu      sync.Mutex
+	files   map[string]string // branch + ":" + path to content
+	commits map[string]string // branch + ":" + path to the last commit that touched it
+	version int
+}
+
+func (g *testGitlab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/repository/files/"):
+		key := r.URL.Query().Get("ref") + ":" + r.URL.Path[strings.Index(r.URL.Path, "/repository/files/")+len("/repository/files/"):]
+		content, exists := g.files[key]
+		if !exists {
+			http.Error(w, `{"message":"404 File Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(gitlabFile{Encoding: "base64", Content: base64.StdEncoding.EncodeToString([]byte(content)), LastCommitID: g.commits[key]})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/repository/commits"):
+		commit := struct {
+			Branch  string              `json:"branch"`
+			Actions []map[string]string `json:"actions"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&commit)
+		g.version++
+		id := fmt.Sprintf("commit%d", g.version)
+		for _, action := range commit.Actions {
+			key := commit.Branch + ":" + action["file_path"]
+			_, exists := g.files[key]
+			switch action["action"] {
+			case "create":
+				if exists {
+					http.Error(w, `{"message":"A file with this name already exists"}`, http.StatusBadRequest)
+					return
+				}
+			case "update", "delete":
+				if !exists || (action["last_commit_id"] != "" && action["last_commit_id"] != g.commits[key]) {
+					http.Error(w, `{"message":"You are attempting to update a file that has changed since you started editing it."}`, http.StatusBadRequest)
+					return
+				}
+			}
+			if action["action"] == "delete" {
+				delete(g.files, key)
+				delete(g.commits, key)
+				continue
+			}
+			g.files[key] = action["content"]
+			g.commits[key] = id
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%q}`, id)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestGitlabStoreConflict(t *testing.T) {
+	gitlab := &testGitlab{files: map[string]string{}, commits: map[string]string{}}
+	server := httptest.NewServer(gitlab)
+	defer server.Close()
+	config := Config{GitlabBaseURL: server.URL, GitlabProject: "group/project", GitlabBranch: "status"}
+	first, err := newGitlabStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newGitlabStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both runners start from scratch, only the first one can create the file
+	if _, err := first.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Load(); err != nil {
+		t.Fatal(err)
+	}
+	err = first.Save(Status{Articles: []PublishedArticle{{ID: "one"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := gitlab.files["status:status.json"]; !exists {
+		t.Fatalf("status.json was not committed to GITLAB_BRANCH, files: %v", gitlab.files)
+	}
+	err = second.Save(Status{Articles: []PublishedArticle{{ID: "two"}}})
+	if !errors.Is(err, ErrStatusConflict) {
+		t.Fatalf("Save() over a newer file = %v, want ErrStatusConflict", err)
+	}
+
+	// the first runner can save again on top of its own commit
+	err = first.Save(Status{Articles: []PublishedArticle{{ID: "one"}, {ID: "three"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after loading the new version the second runner can save, and the first one now conflicts
+	status, err := second.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Articles) != 2 {
+		t.Fatalf("Load() = %+v, want the first runner's status", status)
+	}
+	err = second.Save(Status{Articles: append(status.Articles, PublishedArticle{ID: "two"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = first.Save(Status{Articles: []PublishedArticle{{ID: "one"}, {ID: "four"}}})
+	if !errors.Is(err, ErrStatusConflict) {
+		t.Fatalf("Save() with a stale last commit = %v, want ErrStatusConflict", err)
+	}
+
+	// the lock lives on the same branch
+	release, err := first.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Lock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock() = %v, want ErrLocked", err)
+	}
+	err = release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := gitlab.files["status:status.json.lock"]; exists {
+		t.Fatal("the lock was not released")
+	}
+}
+
+func TestGitlabStoreOtherErrors(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		body   string
+	}{
+		"unknown branch":     {http.StatusBadRequest, `{"message":"You can only create or edit files when you are on a branch"}`},
+		"missing permission": {http.StatusForbidden, `{"message":"403 Forbidden"}`},
+		"invalid request":    {http.StatusBadRequest, `{"error":"actions[0][file_path] is empty"}`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					http.Error(w, `{"message":"404 File Not Found"}`, http.StatusNotFound)
+					return
+				}
+				http.Error(w, test.body, test.status)
+			}))
+			defer server.Close()
+			store, err := newGitlabStore(Config{GitlabBaseURL: server.URL, GitlabProject: "group/project"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Load(); err != nil {
+				t.Fatal(err)
+			}
+			err = store.Save(Status{})
+			if err == nil || errors.Is(err, ErrStatusConflict) {
+				t.Fatalf("Save() = %v, want an error that is not ErrStatusConflict", err)
+			}
+			_, err = store.Lock()
+			if err == nil || errors.Is(err, ErrLocked) {
+				t.Fatalf("Lock() = %v, want an error that is not ErrLocked", err)
+			}
+		})
+	}
+}
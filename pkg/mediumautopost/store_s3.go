@@ -0,0 +1,322 @@
+package mediumautopost
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 is the storage type for keeping the publish status in an S3 compatible bucket (AWS S3, MinIO, R2...).
+const S3 StorageType = "S3"
+
+// s3Store keeps the publish status as a json object in an S3 compatible bucket.
+// the ETag seen by Load is sent with Save as a conditional write, so if another runner
+// changed the object in the meantime the save fails with ErrStatusConflict instead of overwriting it.
+type s3Store struct {
+	client          http.Client
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	key             string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	lockTTL         time.Duration
+
+	// etag of the object as of the last Load. empty if the object did not exist.
+	etag string
+}
+
+func newS3Store(c Config) (StatusStore, error) {
+	if c.S3Bucket == "" {
+		return nil, errors.New("STORAGE_TYPE is S3 but S3_BUCKET is empty")
+	}
+	region := c.S3Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := c.S3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT: %v", err)
+	}
+	key := strings.TrimPrefix(c.S3Key, "/")
+	if key == "" {
+		key = "status.json"
+	}
+	return &s3Store{
+		client:          http.Client{Timeout: 30 * time.Second},
+		endpoint:        u,
+		region:          region,
+		bucket:          c.S3Bucket,
+		key:             key,
+		accessKeyID:     c.S3AccessKeyID,
+		secretAccessKey: c.S3SecretAccessKey,
+		sessionToken:    c.S3SessionToken,
+		lockTTL:         c.LockTTL,
+	}, nil
+}
+
+// Load downloads the status object. if it does not exist yet an empty list is returned so the run starts from scratch.
+func (s *s3Store) Load() (Status, error) {
+	status, _ := decodeStatus(nil)
+	log.Printf("S3 storage type detected. Pulling s3://%s/%s", s.bucket, s.key)
+	resp, err := s.do(http.MethodGet, s.key, nil, nil)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		log.Printf("no %s object found. starting from scratch", s.key)
+		s.etag = ""
+		return status, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return status, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("s3 get %s: %s: %s", s.key, resp.Status, body)
+	}
+	s.etag = resp.Header.Get("ETag")
+
+	return decodeStatus(body)
+}
+
+// Save uploads the status object, but only if it has not changed since Load.
+func (s *s3Store) Save(status Status) error {
+	filebytes, err := encodeStatus(status)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	if s.etag != "" {
+		headers["If-Match"] = s.etag
+	} else {
+		headers["If-None-Match"] = "*"
+	}
+	resp, err := s.do(http.MethodPut, s.key, filebytes, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("s3 put %s: %w", s.key, ErrStatusConflict)
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("s3 put %s: %s: %s", s.key, resp.Status, body)
+	}
+	s.etag = resp.Header.Get("ETag")
+	return nil
+}
+
+// Lock writes a lock object next to the status object. it uses the same conditional writes as Save,
+// so only one runner can create it or take it over once it has expired.
+func (s *s3Store) Lock() (func() error, error) {
+	return acquireLock(s, s.lockTTL)
+}
+
+func (s *s3Store) lockKey() string {
+	return s.key + ".lock"
+}
+
+// putLock writes the lock object with the given condition header and reports whether the condition held.
+func (s *s3Store) putLock(info lockInfo, conditionHeader, conditionValue string) (bool, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.do(http.MethodPut, s.lockKey(), data, map[string]string{
+		"Content-Type":  "application/json",
+		conditionHeader: conditionValue,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+		return false, nil
+	case resp.StatusCode/100 != 2:
+		return false, fmt.Errorf("s3 put %s: %s: %s", s.lockKey(), resp.Status, body)
+	}
+	return true, nil
+}
+
+func (s *s3Store) createLock(info lockInfo) (bool, error) {
+	return s.putLock(info, "If-None-Match", "*")
+}
+
+// readLock uses the ETag of the lock object as its version.
+func (s *s3Store) readLock() (lockInfo, string, bool, error) {
+	resp, err := s.do(http.MethodGet, s.lockKey(), nil, nil)
+	if err != nil {
+		return lockInfo{}, "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return lockInfo{}, "", false, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return lockInfo{}, "", false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return lockInfo{}, "", false, fmt.Errorf("s3 get %s: %s: %s", s.lockKey(), resp.Status, body)
+	}
+	return parseLockInfo(body), resp.Header.Get("ETag"), true, nil
+}
+
+func (s *s3Store) replaceLock(info lockInfo, version string) (bool, error) {
+	return s.putLock(info, "If-Match", version)
+}
+
+func (s *s3Store) deleteLock(version string) error {
+	resp, err := s.do(http.MethodDelete, s.lockKey(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("s3 delete %s: %s: %s", s.lockKey(), resp.Status, body)
+	}
+	return nil
+}
+
+// do sends a signed request for an object in the bucket. path style addressing is used
+// because it works the same on AWS, MinIO and R2.
+func (s *s3Store) do(method string, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	s.sign(req, body, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds an AWS signature version 4 Authorization header to the request.
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *s3Store) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	if s.accessKeyID == "" {
+		// anonymous access, e.g. a local MinIO with a public bucket
+		return
+	}
+
+	signed := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "if-match" || lk == "if-none-match" {
+			signed[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := []string{}
+	for k := range signed {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, k := range names {
+		canonicalHeaders += k + ":" + signed[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEscape(req.URL.Path),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, scope, signedHeaders, signature))
+}
+
+// awsURIEscape encodes a path the way SigV4 expects: everything but unreserved characters and "/" is percent encoded.
+func awsURIEscape(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsCanonicalQuery encodes the query string the way SigV4 expects: sorted by name, every name and value
+// percent encoded like awsURIEscape and a name without a value written as "name=".
+func awsCanonicalQuery(query url.Values) string {
+	names := []string{}
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := []string{}
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, strings.Replace(awsURIEscape(name), "/", "%2F", -1)+"="+strings.Replace(awsURIEscape(value), "/", "%2F", -1))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func init() {
+	RegisterStatusStore(S3, newS3Store)
+}
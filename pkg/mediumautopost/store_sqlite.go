@@ -0,0 +1,395 @@
+package mediumautopost
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure go sqlite driver so CGO_ENABLED=0 builds keep working
+)
+
+// SQLite is the storage type for keeping the publish status in a local sqlite database.
+const SQLite StorageType = "SQLITE"
+
+// sqliteSchema creates the tables on first use. articles are looked up by id (the primary key)
+// and by canonical url, see lookupArticles. every call to Save records a row in runs. the run lock is a row in locks.
+// this is the layout of schema version 1, sqliteMigrations bring it up to date.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS published_articles (
+	id                TEXT PRIMARY KEY,
+	url               TEXT NOT NULL,
+	publish_timestamp TEXT NOT NULL,
+	medium_response   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS published_articles_url ON published_articles (url);
+CREATE TABLE IF NOT EXISTS runs (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	finished_at    TEXT NOT NULL,
+	total_articles INTEGER NOT NULL,
+	new_articles   INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS locks (
+	name  TEXT PRIMARY KEY,
+	token TEXT NOT NULL,
+	info  TEXT NOT NULL
+);
+`
+
+// sqliteMigrations upgrade the tables, the statements at index i take the database from version i+1 to i+2.
+// the version is kept in PRAGMA user_version (0 means version 1, before versions were recorded).
+// rows written by version 1 keep an empty platforms column until they are saved again, see Status.Version.
+// version 3 adds source_state, where the state of stateful article sources is kept.
+// version 4 adds failed_articles, the retry queue. each row is a FailedArticle as json.
+// version 5 creates the index on url again, a development version dropped it.
+var sqliteMigrations = []string{
+	`ALTER TABLE published_articles ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE published_articles ADD COLUMN platforms TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS source_state (
+		source TEXT PRIMARY KEY,
+		state  TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS failed_articles (
+		id      TEXT PRIMARY KEY,
+		failure TEXT NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS published_articles_url ON published_articles (url);`,
+}
+
+// sqliteStore keeps the publish status in a sqlite database at SQLITE_PATH.
+// unlike the json backends only the new or changed records are written on each run.
+type sqliteStore struct {
+	db      *sql.DB
+	lockTTL time.Duration
+}
+
+func newSQLiteStore(c Config) (StatusStore, error) {
+	if c.SQLitePath == "" {
+		return nil, errors.New("STORAGE_TYPE is SQLITE but SQLITE_PATH is empty")
+	}
+	db, err := sql.Open("sqlite", c.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows one writer at a time, a single connection avoids "database is locked" errors
+	db.SetMaxOpenConns(1)
+	err = migrateSQLite(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db, lockTTL: c.LockTTL}, nil
+}
+
+// migrateSQLite creates the tables if needed and applies the migrations the database has not seen yet.
+func migrateSQLite(db *sql.DB) error {
+	_, err := db.Exec(sqliteSchema)
+	if err != nil {
+		return err
+	}
+	version := 0
+	err = db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		version = 1
+	}
+	for ; version-1 < len(sqliteMigrations); version++ {
+		log.Printf("migrating sqlite tables to version %v", version+1)
+		_, err = db.Exec(sqliteMigrations[version-1])
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteLookupBatch is the number of ids or urls looked up per query, well below sqlite's limit of variables.
+const sqliteLookupBatch = 500
+
+// Load reads every published article from the database. rows still in the version 1 layout are upgraded
+// on the fly and the status is reported as version 1 until they are saved again.
+func (s *sqliteStore) Load() (Status, error) {
+	status, err := s.loadState()
+	if err != nil {
+		return status, err
+	}
+	articles, v1, err := s.queryArticles(`SELECT id, url, publish_timestamp, content_hash, platforms, medium_response FROM published_articles ORDER BY rowid`)
+	if err != nil {
+		return status, err
+	}
+	status.Articles = articles
+	if v1 {
+		status.Version = 1
+	}
+	return status, nil
+}
+
+// loadState reads the status without the published articles: the state of the sources and the retry queue.
+// a run looks up the articles it needs with lookupArticles instead of reading all of them.
+func (s *sqliteStore) loadState() (Status, error) {
+	log.Println("SQLITE storage type detected. Using sqlite database for status storage")
+	status, _ := decodeStatus(nil)
+	sources, err := s.db.Query(`SELECT source, state FROM source_state`)
+	if err != nil {
+		return status, err
+	}
+	defer sources.Close()
+	for sources.Next() {
+		var source, state string
+		err = sources.Scan(&source, &state)
+		if err != nil {
+			return status, err
+		}
+		if status.Sources == nil {
+			status.Sources = map[string]json.RawMessage{}
+		}
+		status.Sources[source] = json.RawMessage(state)
+	}
+	err = sources.Err()
+	if err != nil {
+		return status, err
+	}
+
+	failures, err := s.db.Query(`SELECT failure FROM failed_articles ORDER BY rowid`)
+	if err != nil {
+		return status, err
+	}
+	defer failures.Close()
+	for failures.Next() {
+		var data string
+		err = failures.Scan(&data)
+		if err != nil {
+			return status, err
+		}
+		failure := FailedArticle{}
+		err = json.Unmarshal([]byte(data), &failure)
+		if err != nil {
+			return status, err
+		}
+		status.Failures = append(status.Failures, failure)
+	}
+	return status, failures.Err()
+}
+
+// lookupArticles returns the published articles with one of the ids or canonical urls, using the primary key
+// and the index on url.
+func (s *sqliteStore) lookupArticles(ids, urls []string) ([]PublishedArticle, error) {
+	found := []PublishedArticle{}
+	seen := map[string]bool{}
+	for _, lookup := range []struct {
+		column string
+		values []string
+	}{{"id", ids}, {"url", urls}} {
+		for start := 0; start < len(lookup.values); start += sqliteLookupBatch {
+			end := start + sqliteLookupBatch
+			if end > len(lookup.values) {
+				end = len(lookup.values)
+			}
+			args := []interface{}{}
+			for _, value := range lookup.values[start:end] {
+				args = append(args, value)
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+			articles, _, err := s.queryArticles(`SELECT id, url, publish_timestamp, content_hash, platforms, medium_response
+				FROM published_articles WHERE `+lookup.column+` IN (`+placeholders+`) ORDER BY rowid`, args...)
+			if err != nil {
+				return nil, err
+			}
+			for _, article := range articles {
+				if !seen[article.ID] {
+					seen[article.ID] = true
+					found = append(found, article)
+				}
+			}
+		}
+	}
+	return found, nil
+}
+
+// queryArticles reads the published articles a query selects. rows in the version 1 layout are upgraded,
+// v1 reports whether there were any.
+func (s *sqliteStore) queryArticles(query string, args ...interface{}) (articles []PublishedArticle, v1 bool, err error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	articles = []PublishedArticle{}
+	for rows.Next() {
+		var timestamp, platforms, mediumResponse string
+		article := PublishedArticle{}
+		err = rows.Scan(&article.ID, &article.URL, &timestamp, &article.ContentHash, &platforms, &mediumResponse)
+		if err != nil {
+			return nil, false, err
+		}
+		if platforms == "" {
+			old := publishedArticleV1{ID: article.ID, URL: article.URL, PublishTimestamp: timestamp}
+			err = json.Unmarshal([]byte(mediumResponse), &old.MediumPostResponse)
+			if err != nil {
+				return nil, false, err
+			}
+			article = old.upgrade()
+			v1 = true
+		} else {
+			article.PublishTimestamp = parseV1Timestamp(timestamp)
+			err = json.Unmarshal([]byte(platforms), &article.Platforms)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		articles = append(articles, article)
+	}
+	return articles, v1, rows.Err()
+}
+
+// Save inserts the articles that are not in the database yet, updates the ones that changed and records the run.
+// articles that are not in the status are kept, so a status with only the articles from lookupArticles can be saved.
+func (s *sqliteStore) Save(status Status) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before := int64(0)
+	err = tx.QueryRow(`SELECT COUNT(*) FROM published_articles`).Scan(&before)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO published_articles (id, url, publish_timestamp, content_hash, platforms, medium_response)
+		VALUES (?, ?, ?, ?, ?, '') ON CONFLICT (id) DO UPDATE SET
+			url = excluded.url,
+			publish_timestamp = excluded.publish_timestamp,
+			content_hash = excluded.content_hash,
+			platforms = excluded.platforms,
+			medium_response = ''
+		WHERE url != excluded.url OR publish_timestamp != excluded.publish_timestamp
+			OR content_hash != excluded.content_hash OR platforms != excluded.platforms`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, article := range status.Articles {
+		platforms, err := json.Marshal(article.Platforms)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(article.ID, article.URL, article.PublishTimestamp.UTC().Format(time.RFC3339Nano), article.ContentHash, string(platforms))
+		if err != nil {
+			return err
+		}
+	}
+
+	// the state of a source can be dropped (see requeueArticle), so the table is rewritten as a whole too
+	_, err = tx.Exec(`DELETE FROM source_state`)
+	if err != nil {
+		return err
+	}
+	for source, state := range status.Sources {
+		_, err = tx.Exec(`INSERT INTO source_state (source, state) VALUES (?, ?)`, source, string(state))
+		if err != nil {
+			return err
+		}
+	}
+
+	// the retry queue is small and entries are removed, so it is rewritten as a whole
+	_, err = tx.Exec(`DELETE FROM failed_articles`)
+	if err != nil {
+		return err
+	}
+	for _, failure := range status.Failures {
+		data, err := json.Marshal(failure)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO failed_articles (id, failure) VALUES (?, ?)`, failure.ID, string(data))
+		if err != nil {
+			return err
+		}
+	}
+
+	after := int64(0)
+	err = tx.QueryRow(`SELECT COUNT(*) FROM published_articles`).Scan(&after)
+	if err != nil {
+		return err
+	}
+	newArticles := after - before
+
+	_, err = tx.Exec(`INSERT INTO runs (finished_at, total_articles, new_articles) VALUES (?, ?, ?)`,
+		time.Now().UTC().Format(time.RFC3339), after, newArticles)
+	if err != nil {
+		return err
+	}
+	log.Printf("saved %v new articles to sqlite", newArticles)
+	return tx.Commit()
+}
+
+// Lock inserts the run row in the locks table. the inserts and updates are conditional single statements
+// so sqlite guarantees only one run gets the lock.
+func (s *sqliteStore) Lock() (func() error, error) {
+	return acquireLock(s, s.lockTTL)
+}
+
+func (s *sqliteStore) createLock(info lockInfo) (bool, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.Exec(`INSERT INTO locks (name, token, info) VALUES ('run', ?, ?) ON CONFLICT (name) DO NOTHING`, info.Token, string(data))
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
+
+// readLock uses the token of the lock row as its version.
+func (s *sqliteStore) readLock() (lockInfo, string, bool, error) {
+	var token, data string
+	err := s.db.QueryRow(`SELECT token, info FROM locks WHERE name = 'run'`).Scan(&token, &data)
+	if err == sql.ErrNoRows {
+		return lockInfo{}, "", false, nil
+	}
+	if err != nil {
+		return lockInfo{}, "", false, err
+	}
+	return parseLockInfo([]byte(data)), token, true, nil
+}
+
+func (s *sqliteStore) replaceLock(info lockInfo, version string) (bool, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.Exec(`UPDATE locks SET token = ?, info = ? WHERE name = 'run' AND token = ?`, info.Token, string(data), version)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated == 1, err
+}
+
+func (s *sqliteStore) deleteLock(version string) error {
+	_, err := s.db.Exec(`DELETE FROM locks WHERE name = 'run' AND token = ?`, version)
+	return err
+}
+
+// Close closes the database once the run is finished.
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func init() {
+	RegisterStatusStore(SQLite, newSQLiteStore)
+}
@@ -0,0 +1,153 @@
+package mediumautopost
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	config := Config{StorageType: SQLite, SQLitePath: filepath.Join(t.TempDir(), "status.db")}
+	var db *sqliteStore
+	err := withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+		db = store.(*sqliteStore)
+		status, err := store.Load()
+		if err != nil {
+			return err
+		}
+		status.Articles = append(status.Articles, PublishedArticle{ID: "one", URL: "https://example.com/one"})
+		status.Failures = append(status.Failures, FailedArticle{ID: "two", Attempts: 1})
+		err = store.Save(status)
+		if err != nil {
+			return err
+		}
+		status, err = store.Load()
+		if err != nil {
+			return err
+		}
+		if len(status.Articles) != 1 || status.Articles[0].ID != "one" || len(status.Failures) != 1 {
+			t.Fatalf("Load() after Save() = %+v", status)
+		}
+
+		version, indexes := 0, 0
+		err = db.db.QueryRow(`PRAGMA user_version`).Scan(&version)
+		if err != nil {
+			return err
+		}
+		err = db.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'published_articles_url'`).Scan(&indexes)
+		if err != nil {
+			return err
+		}
+		if version != len(sqliteMigrations)+1 || indexes != 1 {
+			t.Fatalf("schema version %v with %v url indexes, want version %v with the index", version, indexes, len(sqliteMigrations)+1)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.db.Ping(); err == nil {
+		t.Fatal("the database is still open after the run")
+	}
+}
+
+func TestSQLiteLookupArticles(t *testing.T) {
+	store, err := newSQLiteStore(Config{SQLitePath: filepath.Join(t.TempDir(), "status.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.(*sqliteStore)
+	defer db.Close()
+	status := Status{}
+	for i := 0; i < sqliteLookupBatch+10; i++ {
+		status.Articles = append(status.Articles, PublishedArticle{ID: fmt.Sprint("id", i), URL: fmt.Sprint("https://example.com/", i)})
+	}
+	err = store.Save(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more ids than fit in one query, an unknown one and an article found by both id and url
+	ids := []string{"id0", "id3", "missing", fmt.Sprint("id", sqliteLookupBatch+5)}
+	for i := 100; i < sqliteLookupBatch+1; i++ {
+		ids = append(ids, fmt.Sprint("id", i))
+	}
+	found, err := db.lookupArticles(ids, []string{"https://example.com/7", "https://example.com/3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every id but the missing one, plus id7 found by its url
+	if want := len(ids); len(found) != want {
+		t.Fatalf("lookupArticles() found %v articles, want %v", len(found), want)
+	}
+	byID := map[string]PublishedArticle{}
+	for _, article := range found {
+		byID[article.ID] = article
+	}
+	if byID["id7"].URL != "https://example.com/7" || byID["id3"].ID == "" || byID["missing"].ID != "" {
+		t.Fatalf("lookupArticles() = %+v", found)
+	}
+
+	// the url lookup uses the index
+	plan := []string{}
+	rows, err := db.db.Query(`EXPLAIN QUERY PLAN SELECT id FROM published_articles WHERE url IN (?)`, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		rows.Scan(pointers...)
+		plan = append(plan, fmt.Sprint(values[len(values)-1]))
+	}
+	if !strings.Contains(strings.Join(plan, "\n"), "published_articles_url") {
+		t.Fatalf("the url lookup does not use the index: %v", plan)
+	}
+}
+
+func TestPublishWithSQLite(t *testing.T) {
+	site := testSite(t, "one", "two")
+	medium := newTestMedium(t)
+	config := testConfig(t, site, medium)
+	config.StorageType = SQLite
+	config.SQLitePath = filepath.Join(t.TempDir(), "status.db")
+
+	// an article posted long ago that is not on the site anymore is kept, but not needed by the run
+	err := withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+		return store.Save(Status{Articles: []PublishedArticle{{ID: "old", URL: "https://example.com/old"}, {ID: "one", URL: site.URL + "/posts/one/"}}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		err = withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+			return publish(ctx, config, store)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(medium.posts) != 1 || medium.posts[0].Title != "Article two" {
+		t.Fatalf("posted %+v, want only article two once", medium.posts)
+	}
+	err = withStatusStore(config, func(ctx context.Context, store StatusStore) error {
+		status, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if len(status.Articles) != 3 {
+			t.Fatalf("status articles = %+v, want old, one and two", status.Articles)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
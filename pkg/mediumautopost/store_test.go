@@ -0,0 +1,88 @@
+package mediumautopost
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// memoryStore is a StatusStore that keeps the encoded status in memory, so the publishing flow can be tested
+// without a backend. like the json backends it round trips the status through encodeStatus and decodeStatus.
+type memoryStore struct {
+	mu     sync.Mutex
+	data   []byte
+	saves  int
+	locked bool
+}
+
+func (s *memoryStore) Load() (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return decodeStatus(s.data)
+}
+
+func (s *memoryStore) Save(status Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := encodeStatus(status)
+	if err != nil {
+		return err
+	}
+	s.data = data
+	s.saves++
+	return nil
+}
+
+func (s *memoryStore) Lock() (func() error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return nil, ErrLocked
+	}
+	s.locked = true
+	return func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.locked = false
+		return nil
+	}, nil
+}
+
+func TestRegisterStatusStore(t *testing.T) {
+	store := &memoryStore{}
+	RegisterStatusStore("memory", func(c Config) (StatusStore, error) { return store, nil })
+
+	got, err := NewStatusStore("MEMORY", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != store {
+		t.Fatalf("NewStatusStore returned %v, want the registered store", got)
+	}
+	found := false
+	for _, storageType := range StorageTypes() {
+		found = found || storageType == "MEMORY"
+	}
+	if !found {
+		t.Fatalf("StorageTypes() = %v, want it to contain MEMORY", StorageTypes())
+	}
+	if _, err := NewStatusStore("NOPE", Config{}); err == nil {
+		t.Fatal("NewStatusStore of an unknown type succeeded")
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	store := &memoryStore{}
+	err := withLock(store, func(ctx context.Context) error {
+		if _, err := store.Lock(); err != ErrLocked {
+			t.Fatalf("second Lock() = %v, want ErrLocked", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.locked {
+		t.Fatal("lock was not released")
+	}
+}